@@ -1,21 +1,28 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-resty/resty/v2"
-	"github.com/mitchellh/mapstructure"
 	"github.com/splitio/go-split-commons/dtos"
 )
 
 const (
-	splitioAPIUri        = "https://sdk.split.io/api"
-	firstRequestSince    = int64(-1)
-	defaultMaxRequestNum = 100
+	splitioAPIUri             = "https://sdk.split.io/api"
+	firstRequestSince         = int64(-1)
+	defaultMaxRequestNum      = 100
+	defaultSegmentConcurrency = 4
+	// missingTill is set as the till of a page before decoding a response to detect responses without till
+	missingTill = int64(math.MinInt64)
 )
 
 // Splitio interface continas two functions to get Splits and Segments
@@ -24,59 +31,198 @@ type Splitio interface {
 	GetSegmentsForSplits(map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error)
 }
 
-// SplitioAPIBinding contains splitioAPIKey
+// IncrementalSplitio is a Splitio that can resume split synchronization from a previous till
+type IncrementalSplitio interface {
+	Splitio
+	GetSplitChanges(since int64, splits map[string]dtos.SplitDTO) (map[string]dtos.SplitDTO, int64, error)
+}
+
+// SplitioContext is an IncrementalSplitio whose requests can be bounded and cancelled with a context
+type SplitioContext interface {
+	IncrementalSplitio
+	GetSplitsContext(ctx context.Context) (map[string]dtos.SplitDTO, int64, error)
+	GetSplitChangesContext(ctx context.Context, since int64, splits map[string]dtos.SplitDTO) (map[string]dtos.SplitDTO, int64, error)
+	GetSegmentsForSplitsContext(ctx context.Context, splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error)
+}
+
+// SplitioAPIBinding contains splitioAPIKey, the HTTP client shared by all requests and the synchronized state of segments
 type SplitioAPIBinding struct {
-	splitioAPIKey string
-	splitioAPIUri string
+	splitioAPIKey      string
+	splitioAPIUri      string
+	segmentConcurrency int
+	maxRequestNum      int
+	retryPolicy        RetryPolicy
+	httpClient         *http.Client
+	transport          http.RoundTripper
+	timeout            time.Duration
+	client             *resty.Client
+	segments           *segmentStore
+}
+
+// Option configures optional behaviors of a SplitioAPIBinding
+type Option func(*SplitioAPIBinding)
+
+// WithSegmentConcurrency sets the maximum number of segments fetched in parallel, defaults to 4
+func WithSegmentConcurrency(concurrency int) Option {
+	return func(binding *SplitioAPIBinding) {
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		binding.segmentConcurrency = concurrency
+	}
+}
+
+// WithMaxRequestNum sets the maximum number of pages of changes requested to receive all the changes
+// of the splits or of a segment, defaults to 100. The final request confirming that all the changes
+// were received is not counted.
+func WithMaxRequestNum(maxRequestNum int) Option {
+	return func(binding *SplitioAPIBinding) {
+		if maxRequestNum < 1 {
+			maxRequestNum = 1
+		}
+		binding.maxRequestNum = maxRequestNum
+	}
+}
+
+// WithRetryPolicy sets how failed requests are retried, defaults to DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(binding *SplitioAPIBinding) {
+		if policy.MaxAttempts < 1 {
+			policy.MaxAttempts = 1
+		}
+		policy.Jitter = clampJitter(policy.Jitter)
+		binding.retryPolicy = policy
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests, e.g. to configure a proxy or custom CAs.
+// The client is copied so it is not modified by the other options.
+func WithHTTPClient(client *http.Client) Option {
+	return func(binding *SplitioAPIBinding) {
+		binding.httpClient = client
+	}
+}
+
+// WithTransport sets the http.RoundTripper used for all requests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(binding *SplitioAPIBinding) {
+		binding.transport = transport
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request, including reading the response body
+func WithTimeout(timeout time.Duration) Option {
+	return func(binding *SplitioAPIBinding) {
+		binding.timeout = timeout
+	}
 }
 
 // NewSplitioAPIBinding returns a new SplitioAPIBinding
-func NewSplitioAPIBinding(apiKey string, apiURL string) *SplitioAPIBinding {
+func NewSplitioAPIBinding(apiKey string, apiURL string, options ...Option) *SplitioAPIBinding {
 	if apiURL == "" {
 		apiURL = splitioAPIUri
 	}
-	return &SplitioAPIBinding{apiKey, apiURL}
+	binding := &SplitioAPIBinding{
+		splitioAPIKey:      apiKey,
+		splitioAPIUri:      apiURL,
+		segmentConcurrency: defaultSegmentConcurrency,
+		maxRequestNum:      defaultMaxRequestNum,
+		retryPolicy:        DefaultRetryPolicy(),
+		segments:           newSegmentStore(),
+	}
+	for _, option := range options {
+		option(binding)
+	}
+	binding.client = binding.newClient()
+	return binding
+}
+
+// newClient returns the HTTP client shared by all requests of the binding
+func (binding *SplitioAPIBinding) newClient() *resty.Client {
+	client := resty.New()
+	if binding.httpClient != nil {
+		httpClient := *binding.httpClient
+		client = resty.NewWithClient(&httpClient)
+	}
+	if binding.transport != nil {
+		client.SetTransport(binding.transport)
+	}
+	if binding.timeout > 0 {
+		client.SetTimeout(binding.timeout)
+	}
+	return client.SetHeaders(map[string]string{
+		"Accept":        "application/json",
+		"Authorization": fmt.Sprintf("Bearer %s", binding.splitioAPIKey),
+	})
 }
 
 // GetSplits gets the split data
 func (binding *SplitioAPIBinding) GetSplits() (map[string]dtos.SplitDTO, int64, error) {
+	return binding.GetSplitsContext(context.Background())
+}
+
+// GetSplitsContext gets the split data, stopping when ctx is done
+func (binding *SplitioAPIBinding) GetSplitsContext(ctx context.Context) (map[string]dtos.SplitDTO, int64, error) {
+	return binding.GetSplitChangesContext(ctx, firstRequestSince, nil)
+}
+
+// GetSplitChanges requests the split changes made after since and applies them on top of splits.
+// The splits map passed in is not modified, a merged copy is returned along with the new till.
+func (binding *SplitioAPIBinding) GetSplitChanges(since int64, splits map[string]dtos.SplitDTO) (map[string]dtos.SplitDTO, int64, error) {
+	return binding.GetSplitChangesContext(context.Background(), since, splits)
+}
+
+// GetSplitChangesContext is GetSplitChanges stopping when ctx is done
+func (binding *SplitioAPIBinding) GetSplitChangesContext(ctx context.Context, since int64, splits map[string]dtos.SplitDTO) (map[string]dtos.SplitDTO, int64, error) {
 	path := "splitChanges"
-	splits := map[string]dtos.SplitDTO{}
-	allChanges, since, err := binding.getAllChanges(path)
+	allChanges := []dtos.SplitChangesDTO{}
+	since, err := binding.getAllChanges(path, since, func(since int64) (int64, error) {
+		splitChanges := dtos.SplitChangesDTO{Till: missingTill}
+		err := binding.httpGet(ctx, path, since, &splitChanges)
+		allChanges = append(allChanges, splitChanges)
+		return splitChanges.Till, err
+	})
 	if err != nil {
 		return nil, 0, err
 	}
 
-	for _, changes := range allChanges {
-		var splitChanges dtos.SplitChangesDTO
-		config := &mapstructure.DecoderConfig{TagName: "json", Result: &splitChanges}
-		decoder, err := mapstructure.NewDecoder(config)
-		if err != nil {
-			return nil, 0, err
-		}
-
-		err = decoder.Decode(changes)
-		if err != nil {
-			err = fmt.Errorf("error when decode data to split: %s", err)
-			return nil, 0, err
-		}
+	mergedSplits := make(map[string]dtos.SplitDTO, len(splits))
+	for name, split := range splits {
+		mergedSplits[name] = split
+	}
 
+	for _, splitChanges := range allChanges {
 		for _, split := range splitChanges.Splits {
 			if split.Status == "ARCHIVED" {
-				delete(splits, split.Name)
+				delete(mergedSplits, split.Name)
 			} else {
-				splits[split.Name] = split
+				mergedSplits[split.Name] = split
 			}
 		}
 	}
 
-	return splits, since, nil
+	return mergedSplits, since, nil
 }
 
 // GetSegmentsForSplits return segment info and the count of splits using segment
 func (binding *SplitioAPIBinding) GetSegmentsForSplits(splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error) {
+	return binding.GetSegmentsForSplitsContext(context.Background(), splits)
+}
+
+// GetSegmentsForSplitsContext is GetSegmentsForSplits stopping when ctx is done
+func (binding *SplitioAPIBinding) GetSegmentsForSplitsContext(ctx context.Context, splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error) {
+	allSegmentNames, usingSegmentsCount := GetSegmentNamesForSplits(splits)
+	segments, err := binding.getSegments(ctx, allSegmentNames)
+	if err != nil {
+		return segments, 0, err
+	}
+
+	return segments, usingSegmentsCount, nil
+}
+
+// GetSegmentNamesForSplits returns the names of the segments used by splits and the count of splits using segments
+func GetSegmentNamesForSplits(splits map[string]dtos.SplitDTO) (map[string]bool, int) {
 	allSegmentNames := map[string]bool{}
-	segments := map[string]dtos.SegmentChangesDTO{}
 	usingSegmentsCount := 0
 
 	for _, split := range splits {
@@ -89,79 +235,161 @@ func (binding *SplitioAPIBinding) GetSegmentsForSplits(splits map[string]dtos.Sp
 		}
 	}
 
-	for segmentName := range allSegmentNames {
-		segment, err := binding.getSegment(segmentName)
-		if err != nil {
-			return segments, 0, err
+	return allSegmentNames, usingSegmentsCount
+}
+
+// getSegments fetches the segments in parallel using at most segmentConcurrency workers.
+// The outstanding requests are cancelled once a request fails, and the first error is returned.
+// The stored state of the segments not in segmentNames is dropped.
+func (binding *SplitioAPIBinding) getSegments(ctx context.Context, segmentNames map[string]bool) (map[string]dtos.SegmentChangesDTO, error) {
+	segments := map[string]dtos.SegmentChangesDTO{}
+	pending := make(chan string)
+	workersCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mutex sync.Mutex
+	var firstErr error
+	var workers sync.WaitGroup
+
+	workerCount := binding.segmentConcurrency
+	if workerCount > len(segmentNames) {
+		workerCount = len(segmentNames)
+	}
+	for i := 0; i < workerCount; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for segmentName := range pending {
+				segment, err := binding.getSegment(workersCtx, segmentName)
+				mutex.Lock()
+				if err == nil {
+					segments[segment.Name] = segment
+				} else if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for segmentName := range segmentNames {
+		select {
+		case <-workersCtx.Done():
+			break dispatch
+		default:
+		}
+		select {
+		case pending <- segmentName:
+		case <-workersCtx.Done():
+			break dispatch
 		}
-		segments[segment.Name] = segment
 	}
+	close(pending)
+	workers.Wait()
+	binding.segments.prune(segmentNames)
 
-	return segments, usingSegmentsCount, nil
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return segments, firstErr
 }
 
-// httpGet makes a GET request to the Split.io SDK API.
+// httpGet makes a GET request to the Split.io SDK API, retrying it according to the retry policy,
+// and decodes the response body into result.
 // path is the path of the HTTP request, either "splitChanges" or "segmentChanges/segmentName"
 // since is an integer used as a query string, will be -1 on the first request
-func (binding *SplitioAPIBinding) httpGet(path string, since int64) (map[string]interface{}, error) {
-	client := resty.New()
-	resp, err := client.R().
+// No more attempts are made once ctx is done.
+func (binding *SplitioAPIBinding) httpGet(ctx context.Context, path string, since int64, result interface{}) error {
+	for attempt := 1; ; attempt++ {
+		retryable, err := binding.httpGetAttempt(ctx, path, since, result)
+		if err == nil || !retryable || attempt >= binding.retryPolicy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(binding.retryPolicy.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// httpGetAttempt makes a single GET request to the Split.io SDK API, streams the response body into result
+// and returns whether the request can be retried when it fails.
+// Rate limited requests are not retried so that the caller can wait as long as Split.io asked.
+func (binding *SplitioAPIBinding) httpGetAttempt(ctx context.Context, path string, since int64, result interface{}) (bool, error) {
+	resp, err := binding.client.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
 		SetQueryParams(map[string]string{
 			"since": strconv.FormatInt(since, 10),
 		}).
-		SetHeaders(map[string]string{
-			"Accept":        "application/json",
-			"Authorization": fmt.Sprintf("Bearer %s", binding.splitioAPIKey),
-		}).
 		Get(fmt.Sprintf("%s/%s", binding.splitioAPIUri, path))
 
 	if err != nil {
-		err = fmt.Errorf("http get request error: %s", err)
-		return map[string]interface{}{}, err
+		err = fmt.Errorf("http get request error: %w", err)
+		return true, err
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if rateLimitErr := newRateLimitError(path, resp.StatusCode(), resp.Status(), resp.Header(), time.Now()); rateLimitErr != nil {
+		return false, rateLimitErr
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		err = fmt.Errorf("non-OK HTTP status: %s", resp.Status())
-		return map[string]interface{}{}, err
+		err = &HTTPError{
+			StatusCode: resp.StatusCode(),
+			Status:     resp.Status(),
+			Path:       path,
+			Segment:    segmentNameFromPath(path),
+		}
+		return binding.retryPolicy.isRetryableStatus(resp.StatusCode()), err
 	}
 
-	var data map[string]interface{}
-	decoder := json.NewDecoder(strings.NewReader(string(resp.Body())))
-	decoder.UseNumber()
-	err = decoder.Decode(&data)
+	err = decodeBody(body, result)
 	if err != nil {
-		err = fmt.Errorf("decode error: %s", err)
-		return map[string]interface{}{}, err
+		err = &DecodeError{Path: path, Segment: segmentNameFromPath(path), Err: err}
+		return false, err
 	}
 
-	return data, nil
+	return false, nil
+}
+
+// decodeBody decodes a JSON response body into result without reading the whole body in memory first
+func decodeBody(body io.Reader, result interface{}) error {
+	return json.NewDecoder(body).Decode(result)
 }
 
 // getAllChanges polls the Split.io API until since and till are the same
 // path is the path of the HTTP request e.g "splitChanges", "segmentChanges/segmentName"
-func (binding *SplitioAPIBinding) getAllChanges(path string) ([]map[string]interface{}, int64, error) {
-	since := firstRequestSince
-	requestCount := 0
-	allChanges := []map[string]interface{}{}
-	for requestCount < defaultMaxRequestNum {
-		results, err := binding.httpGet(path, since)
+// since is the till of the last synchronization, or -1 to request the full history
+// getPage requests and decodes the changes made after the since passed in, and returns the till of the response.
+// A PaginationError is returned when the changes are not all received after maxRequestNum pages of changes,
+// and an InvalidTillError when Split.io responds with a till older than the since requested.
+func (binding *SplitioAPIBinding) getAllChanges(path string, since int64, getPage func(since int64) (int64, error)) (int64, error) {
+	for pageCount := 0; pageCount <= binding.maxRequestNum; pageCount++ {
+		till, err := getPage(since)
 		if err != nil {
-			return nil, 0, err
+			return 0, err
 		}
-		till, err := results["till"].(json.Number).Int64()
-		if err != nil {
-			return nil, 0, err
+		if till == missingTill {
+			return 0, &DecodeError{Path: path, Segment: segmentNameFromPath(path), Err: errors.New("till is missing")}
 		}
 
 		if since == till {
-			break
+			return since, nil
+		}
+		if till < since {
+			return 0, &InvalidTillError{Path: path, Segment: segmentNameFromPath(path), Since: since, Till: till}
 		}
-		allChanges = append(allChanges, results)
 		since = till
-		requestCount++
 	}
 
-	return allChanges, since, nil
+	return 0, &PaginationError{Path: path, Segment: segmentNameFromPath(path), MaxRequestNum: binding.maxRequestNum, Since: since}
 }
 
 func getSegmentNamesInUse(conditions []dtos.ConditionDTO) map[string]bool {
@@ -177,31 +405,39 @@ func getSegmentNamesInUse(conditions []dtos.ConditionDTO) map[string]bool {
 	return segmentNames
 }
 
-// Get info for single segment
-func (binding *SplitioAPIBinding) getSegment(segmentName string) (dtos.SegmentChangesDTO, error) {
+// getSegment gets info for single segment, requesting only the changes made
+// after the till stored for the segment by the previous synchronization
+func (binding *SplitioAPIBinding) getSegment(ctx context.Context, segmentName string) (dtos.SegmentChangesDTO, error) {
 	path := "segmentChanges"
 	segment := dtos.SegmentChangesDTO{}
-	allChanges, since, err := binding.getAllChanges(fmt.Sprintf("%s/%s", path, segmentName))
+	state, found := binding.segments.get(segmentName)
+	since := firstRequestSince
+	if found {
+		since = state.till
+	}
+
+	segmentPath := fmt.Sprintf("%s/%s", path, segmentName)
+	allChanges := []dtos.SegmentChangesDTO{}
+	since, err := binding.getAllChanges(segmentPath, since, func(since int64) (int64, error) {
+		segmentChanges := dtos.SegmentChangesDTO{Till: missingTill}
+		err := binding.httpGet(ctx, segmentPath, since, &segmentChanges)
+		allChanges = append(allChanges, segmentChanges)
+		return segmentChanges.Till, err
+	})
 	if err != nil {
 		return segment, err
 	}
 
-	addedMap := map[string]bool{}
-	for _, changes := range allChanges {
-		var segmentChanges dtos.SegmentChangesDTO
-
-		config := &mapstructure.DecoderConfig{TagName: "json", Result: &segmentChanges}
-		decoder, err := mapstructure.NewDecoder(config)
-		if err != nil {
-			return segment, err
-		}
+	if found && since == state.till {
+		return state.segment, nil
+	}
 
-		err = decoder.Decode(changes)
-		if err != nil {
-			err = fmt.Errorf("error when decode data to segment: %s", err)
-			return segment, err
-		}
+	addedMap := make(map[string]bool, len(state.keys))
+	for id := range state.keys {
+		addedMap[id] = true
+	}
 
+	for _, segmentChanges := range allChanges {
 		for _, id := range segmentChanges.Added {
 			addedMap[id] = true
 		}
@@ -222,6 +458,7 @@ func (binding *SplitioAPIBinding) getSegment(segmentName string) (dtos.SegmentCh
 		Since: since,
 		Till:  since,
 	}
+	binding.segments.set(segmentName, segmentState{till: since, keys: addedMap, segment: segment})
 
 	return segment, nil
 }
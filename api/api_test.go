@@ -1,13 +1,21 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/splitio/go-split-commons/dtos"
 	"github.com/stretchr/testify/assert"
 )
@@ -47,6 +55,34 @@ const (
 type mockHandler struct {
 }
 
+func getSplitChangesPages(binding *SplitioAPIBinding, path string, since int64) ([]dtos.SplitChangesDTO, int64, error) {
+	pages := []dtos.SplitChangesDTO{}
+	since, err := binding.getAllChanges(path, since, func(since int64) (int64, error) {
+		page := dtos.SplitChangesDTO{Till: missingTill}
+		err := binding.httpGet(context.Background(), path, since, &page)
+		pages = append(pages, page)
+		return page.Till, err
+	})
+	if err != nil {
+		return nil, since, err
+	}
+	return pages, since, nil
+}
+
+func splitsUsingSegments(segmentNames ...string) map[string]dtos.SplitDTO {
+	splits := map[string]dtos.SplitDTO{}
+	for _, segmentName := range segmentNames {
+		matcher := dtos.MatcherDTO{
+			MatcherType:        "IN_SEGMENT",
+			UserDefinedSegment: &dtos.UserDefinedSegmentMatcherDataDTO{SegmentName: segmentName},
+		}
+		condition := dtos.ConditionDTO{MatcherGroup: dtos.MatcherGroupDTO{Matchers: []dtos.MatcherDTO{matcher}}}
+		splitName := fmt.Sprintf("split-using-%v", segmentName)
+		splits[splitName] = dtos.SplitDTO{Name: splitName, Conditions: []dtos.ConditionDTO{condition}}
+	}
+	return splits
+}
+
 func (h *mockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	path := r.RequestURI // e.g URI: "/splitCahges?since=-1"
 	since, _ := strconv.Atoi(path[len(path)-2:])
@@ -94,6 +130,92 @@ func TestNewSplitioAPIBindingHasDefaultURI(t *testing.T) {
 	assert.EqualValues(t, result.splitioAPIUri, "https://sdk.split.io/api")
 }
 
+func TestNewSplitioAPIBindingHasDefaultSegmentConcurrency(t *testing.T) {
+	// Act
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, "")
+
+	// Validate that returned NewSplitioAPIBinding has the default segment concurrency
+	assert.Equal(t, result.segmentConcurrency, defaultSegmentConcurrency)
+}
+
+func TestNewSplitioAPIBindingWithSegmentConcurrency(t *testing.T) {
+	// Act
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, "", WithSegmentConcurrency(8))
+	resultWithInvalidConcurrency := NewSplitioAPIBinding(mockSplitioAPIKey, "", WithSegmentConcurrency(0))
+
+	// Validate that the segment concurrency option is applied and is at least 1
+	assert.Equal(t, result.segmentConcurrency, 8)
+	assert.Equal(t, resultWithInvalidConcurrency.segmentConcurrency, 1)
+}
+
+type mockRoundTripper struct {
+	requests []*http.Request
+}
+
+func (roundTripper *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	roundTripper.requests = append(roundTripper.requests, req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewSplitioAPIBindingWithTransport(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"till":1}`)
+	}))
+	defer testServer.Close()
+	transport := &mockRoundTripper{}
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithTransport(transport))
+
+	// Act
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &map[string]interface{}{})
+	secondErr := binding.httpGet(context.Background(), mockPath, mockSince, &map[string]interface{}{})
+
+	// Validate that all requests go through the transport with the Split.io headers
+	assert.Nil(t, err)
+	assert.Nil(t, secondErr)
+	assert.Equal(t, len(transport.requests), 2)
+	assert.Equal(t, transport.requests[0].Header.Get("Authorization"), "Bearer "+mockSplitioAPIKey)
+	assert.Equal(t, transport.requests[0].Header.Get("Accept"), "application/json")
+}
+
+func TestNewSplitioAPIBindingWithHTTPClient(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"till":1}`)
+	}))
+	defer testServer.Close()
+	transport := &mockRoundTripper{}
+	httpClient := &http.Client{Transport: transport}
+
+	// Act
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithHTTPClient(httpClient), WithTimeout(time.Second))
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &map[string]interface{}{})
+
+	// Validate that the HTTP client is used without being modified by the timeout option
+	assert.Nil(t, err)
+	assert.Equal(t, len(transport.requests), 1)
+	assert.Equal(t, binding.client.GetClient().Timeout, time.Second)
+	assert.Equal(t, httpClient.Timeout, time.Duration(0))
+}
+
+func TestNewSplitioAPIBindingWithTimeout(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer testServer.Close()
+	defer close(release)
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL,
+		WithTimeout(50*time.Millisecond), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+
+	// Act
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &map[string]interface{}{})
+
+	// Validate that the request is given up after the timeout
+	assert.Contains(t, err.Error(), "http get request error:")
+}
+
 func TestHttpGetReturnsSuccessfulResponse(t *testing.T) {
 	// Arrange
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -106,7 +228,8 @@ func TestHttpGetReturnsSuccessfulResponse(t *testing.T) {
 		"data": "fake splitio json string",
 	}
 	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
-	result, err := binding.httpGet(mockPath, mockSince)
+	result := map[string]interface{}{}
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &result)
 
 	// Validate that httpGet function returns correct data and empty error
 	assert.Equal(t, result, expectedData)
@@ -122,7 +245,8 @@ func TestHttpGetReturnsErrorOnNonOKResponse(t *testing.T) {
 
 	// Act
 	apiBinding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
-	result, err := apiBinding.httpGet(mockPath, mockSince)
+	result := map[string]interface{}{}
+	err := apiBinding.httpGet(context.Background(), mockPath, mockSince, &result)
 
 	// Validate that httpGet function returns unsuccessful error
 	assert.EqualError(t, err, "non-OK HTTP status: 404 Not Found")
@@ -135,7 +259,8 @@ func TestHttpGetReturnsNewRequestError(t *testing.T) {
 
 	// Act
 	apiBinding := NewSplitioAPIBinding(mockSplitioAPIKey, badURI)
-	result, err := apiBinding.httpGet(mockPath, mockSince)
+	result := map[string]interface{}{}
+	err := apiBinding.httpGet(context.Background(), mockPath, mockSince, &result)
 
 	// Validate that httpGet function returns new request error
 	assert.Contains(t, err.Error(), "http get request error:")
@@ -151,13 +276,120 @@ func TestHttpGetReturnsDecodeError(t *testing.T) {
 
 	// Act
 	apiBinding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
-	result, err := apiBinding.httpGet(mockPath, mockSince)
+	result := map[string]interface{}{}
+	err := apiBinding.httpGet(context.Background(), mockPath, mockSince, &result)
 
 	// Validate that httpGet function returns new request error
 	assert.EqualError(t, err, "decode error: invalid character 'i' looking for beginning of value")
 	assert.Equal(t, result, map[string]interface{}{})
 }
 
+func TestHttpGetRetriesRetryableStatus(t *testing.T) {
+	// Arrange
+	attempts := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(503)
+			return
+		}
+		fmt.Fprintln(w, `{"data":"fake splitio json string"}`)
+	}))
+	defer testServer.Close()
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{503}}
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithRetryPolicy(policy))
+
+	// Act
+	result := map[string]interface{}{}
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &result)
+
+	// Validate that httpGet retries until the request succeeds
+	assert.Nil(t, err)
+	assert.Equal(t, attempts, 3)
+	assert.Equal(t, result, map[string]interface{}{"data": "fake splitio json string"})
+}
+
+func TestHttpGetReturnsErrorAfterMaxAttempts(t *testing.T) {
+	// Arrange
+	attempts := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(502)
+	}))
+	defer testServer.Close()
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{502}}
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithRetryPolicy(policy))
+
+	// Act
+	result := map[string]interface{}{}
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &result)
+
+	// Validate that httpGet gives up after MaxAttempts
+	assert.EqualError(t, err, "non-OK HTTP status: 502 Bad Gateway")
+	assert.Equal(t, attempts, 4)
+	assert.Equal(t, result, map[string]interface{}{})
+}
+
+func TestHttpGetDoesNotRetryNonRetryableStatus(t *testing.T) {
+	// Arrange
+	attempts := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(401)
+	}))
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+
+	// Act
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &map[string]interface{}{})
+
+	// Validate that httpGet makes a single attempt
+	assert.EqualError(t, err, "non-OK HTTP status: 401 Unauthorized")
+	assert.Equal(t, attempts, 1)
+}
+
+func TestHttpGetReturnsRateLimitError(t *testing.T) {
+	// Arrange
+	attempts := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(503)
+	}))
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+
+	// Act
+	err := binding.httpGet(context.Background(), mockPath, mockSince, &map[string]interface{}{})
+
+	// Validate that httpGet does not retry and returns a RateLimitError
+	rateLimitErr, isRateLimitErr := err.(*RateLimitError)
+	assert.True(t, isRateLimitErr)
+	assert.Equal(t, rateLimitErr.RetryAfter, time.Minute)
+	assert.Equal(t, rateLimitErr.Path, mockPath)
+	assert.Equal(t, attempts, 1)
+}
+
+func TestNewSplitioAPIBindingWithRetryPolicy(t *testing.T) {
+	// Act
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, "")
+	resultWithoutRetries := NewSplitioAPIBinding(mockSplitioAPIKey, "", WithRetryPolicy(RetryPolicy{}))
+
+	// Validate that the default retry policy is used unless one is provided, with at least one attempt
+	assert.Equal(t, result.retryPolicy, DefaultRetryPolicy())
+	assert.Equal(t, resultWithoutRetries.retryPolicy.MaxAttempts, 1)
+}
+
+func TestNewSplitioAPIBindingWithRetryPolicyClampsJitter(t *testing.T) {
+	// Act
+	resultWithLargeJitter := NewSplitioAPIBinding(mockSplitioAPIKey, "", WithRetryPolicy(RetryPolicy{Jitter: 3}))
+	resultWithNegativeJitter := NewSplitioAPIBinding(mockSplitioAPIKey, "", WithRetryPolicy(RetryPolicy{Jitter: -1}))
+
+	// Validate that the jitter is limited to the range between 0 and 1
+	assert.Equal(t, resultWithLargeJitter.retryPolicy.Jitter, float64(1))
+	assert.Equal(t, resultWithNegativeJitter.retryPolicy.Jitter, float64(0))
+}
+
 func TestGetAllChangesValid(t *testing.T) {
 	// Arrange
 	handler := &mockHandler{}
@@ -166,17 +398,17 @@ func TestGetAllChangesValid(t *testing.T) {
 	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
 
 	// Act
-	changes, since, err := binding.getAllChanges("splitChanges")
-	expectedSplits := []interface{}{
-		map[string]interface{}{"name": "mock-split-1", "killed": false},
-		map[string]interface{}{"name": "mock-split-2"},
+	changes, since, err := getSplitChangesPages(binding, "splitChanges", firstRequestSince)
+	expectedSplits := []dtos.SplitDTO{
+		{Name: "mock-split-1", Killed: false},
+		{Name: "mock-split-2"},
 	}
 
-	// Valide that getAllChanges returns valid value
+	// Valide that getAllChanges requests pages until since and till are the same
 	assert.Nil(t, err)
 	assert.Equal(t, since, int64(20))
-	assert.Equal(t, changes[0]["splits"], expectedSplits)
-	assert.Equal(t, len(changes), 2)
+	assert.Equal(t, changes[0].Splits, expectedSplits)
+	assert.Equal(t, len(changes), 3)
 }
 
 func TestGetAllChangesReturnsHTTPError(t *testing.T) {
@@ -188,7 +420,7 @@ func TestGetAllChangesReturnsHTTPError(t *testing.T) {
 	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
 
 	// Act
-	changes, since, err := binding.getAllChanges(mockPath)
+	changes, since, err := getSplitChangesPages(binding, mockPath, firstRequestSince)
 
 	// Valide that getAllChanges return getHTTP error
 	assert.EqualError(t, err, "non-OK HTTP status: 404 Not Found")
@@ -205,14 +437,123 @@ func TestGetAllChangesReturnsIntConvertError(t *testing.T) {
 	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
 
 	// Act
-	changes, since, err := binding.getAllChanges(mockPath)
+	changes, since, err := getSplitChangesPages(binding, mockPath, firstRequestSince)
 
 	// Valide that getAllChanges return parsing error
-	assert.EqualError(t, err, "strconv.ParseInt: parsing \"3.15\": invalid syntax")
+	assert.EqualError(t, err, "decode error: json: cannot unmarshal number 3.15 into Go struct field SplitChangesDTO.till of type int64")
+	assert.Nil(t, changes)
+	assert.Equal(t, since, int64(0))
+}
+
+func TestGetAllChangesReturnsPaginationError(t *testing.T) {
+	// Arrange
+	handler := &mockHandler{}
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithMaxRequestNum(1))
+
+	// Act
+	changes, since, err := getSplitChangesPages(binding, "segmentChanges/mock-segment", firstRequestSince)
+
+	// Validate that getAllChanges returns a PaginationError and no partial changes
+	var paginationErr *PaginationError
+	assert.True(t, errors.Is(err, ErrPaginationLimitExceeded))
+	assert.True(t, errors.As(err, &paginationErr))
+	assert.Equal(t, paginationErr.Segment, "mock-segment")
+	assert.Equal(t, paginationErr.MaxRequestNum, 1)
+	assert.Equal(t, paginationErr.Since, int64(40))
+	assert.EqualError(t, err, "changes of segmentChanges/mock-segment not fully received after 1 pages of changes, reached since 40")
 	assert.Nil(t, changes)
 	assert.Equal(t, since, int64(0))
 }
 
+func TestGetAllChangesWithMaxRequestNum(t *testing.T) {
+	// Arrange
+	handler := &mockHandler{}
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithMaxRequestNum(2))
+
+	// Act
+	changes, since, err := getSplitChangesPages(binding, "splitChanges", firstRequestSince)
+
+	// Validate that getAllChanges succeeds when the number of pages of changes is the limit,
+	// the final request confirming that all the changes were received not being counted
+	assert.Nil(t, err)
+	assert.Equal(t, since, int64(20))
+	assert.Equal(t, len(changes), 3)
+}
+
+func TestGetAllChangesAtDefaultMaxRequestNum(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		till := since + 1
+		if since == defaultMaxRequestNum-1 {
+			till = since
+		}
+		fmt.Fprintf(w, `{"splits": [], "since": %d, "till": %d}`, since, till)
+	}))
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+
+	// Act
+	changes, since, err := getSplitChangesPages(binding, "splitChanges", firstRequestSince)
+
+	// Validate that exactly defaultMaxRequestNum pages of changes are all received
+	assert.Nil(t, err)
+	assert.Equal(t, since, int64(defaultMaxRequestNum-1))
+	assert.Equal(t, len(changes), defaultMaxRequestNum+1)
+}
+
+func TestGetAllChangesReturnsInvalidTillError(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"splits": [], "since": 20, "till": 15}`)
+	}))
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+
+	// Act
+	changes, since, err := getSplitChangesPages(binding, "splitChanges", 20)
+
+	// Validate that a till older than since is rejected
+	var invalidTillErr *InvalidTillError
+	assert.True(t, errors.Is(err, ErrInvalidTill))
+	assert.True(t, errors.As(err, &invalidTillErr))
+	assert.Equal(t, invalidTillErr.Till, int64(15))
+	assert.EqualError(t, err, "invalid till for splitChanges: till 15 is older than since 20")
+	assert.Nil(t, changes)
+	assert.Equal(t, since, int64(0))
+}
+
+func TestGetAllChangesReturnsMissingTillError(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"splits": []}`)
+	}))
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+
+	// Act
+	changes, _, err := getSplitChangesPages(binding, "splitChanges", firstRequestSince)
+
+	// Validate that a response without till is a decode error
+	assert.True(t, errors.Is(err, ErrDecode))
+	assert.EqualError(t, err, "decode error: till is missing")
+	assert.Nil(t, changes)
+}
+
+func TestNewSplitioAPIBindingWithMaxRequestNum(t *testing.T) {
+	// Act
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, "")
+	resultWithInvalidMax := NewSplitioAPIBinding(mockSplitioAPIKey, "", WithMaxRequestNum(-1))
+
+	// Validate that the maximum number of requests defaults to 100 and is at least 1
+	assert.Equal(t, result.maxRequestNum, defaultMaxRequestNum)
+	assert.Equal(t, resultWithInvalidMax.maxRequestNum, 1)
+}
+
 func TestGetSplitsValid(t *testing.T) {
 	// Arrange
 	handler := &mockHandler{}
@@ -241,6 +582,56 @@ func TestGetSplitsValid(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestGetSplitChangesResumesFromSince(t *testing.T) {
+	// Arrange
+	handler := &mockHandler{}
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+	previousSplits := map[string]dtos.SplitDTO{
+		"mock-split-1": {Name: "mock-split-1"},
+		"mock-split-2": {Name: "mock-split-2"},
+	}
+
+	// Act
+	splits, since, err := result.GetSplitChanges(10, previousSplits)
+
+	// Validate that GetSplitChanges applies only the deltas on top of the previous splits
+	assert.Nil(t, err)
+	assert.Equal(t, since, int64(20))
+	assert.Equal(t, len(splits), 3)
+	assert.Equal(t, splits["mock-split-1"].Killed, true)
+	_, splitTwoExist := splits["mock-split-2"]
+	assert.False(t, splitTwoExist)
+
+	// Validate that the previous splits are not modified
+	assert.Equal(t, len(previousSplits), 2)
+	assert.Equal(t, previousSplits["mock-split-1"].Killed, false)
+}
+
+func TestGetSplitChangesReturnsPreviousSplitsWhenUpToDate(t *testing.T) {
+	// Arrange
+	requestCount := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		fmt.Fprintln(w, `{"splits": [], "since": 20, "till": 20}`)
+	}))
+	defer testServer.Close()
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+	previousSplits := map[string]dtos.SplitDTO{
+		"mock-split-1": {Name: "mock-split-1"},
+	}
+
+	// Act
+	splits, since, err := result.GetSplitChanges(20, previousSplits)
+
+	// Validate that a single request is made and the previous splits are returned
+	assert.Nil(t, err)
+	assert.Equal(t, requestCount, 1)
+	assert.Equal(t, since, int64(20))
+	assert.Equal(t, splits, previousSplits)
+}
+
 func TestGetSplitsDecodesCorrectly(t *testing.T) {
 	// Arrange
 	mockSplits := fmt.Sprintf(`{"splits":[{"name": "mock-split-1", "conditions":%v}], "since": 1, "till": 1}`, mockConditions)
@@ -301,7 +692,7 @@ func TestGetSplitsReturnsDecodeError(t *testing.T) {
 	// Validate that GetSplits returns decode error
 	assert.Equal(t, since, int64(0))
 	assert.Nil(t, splits)
-	assert.EqualError(t, err, "error when decode data to split: 1 error(s) decoding:\n\n* 'since' expected type 'int64', got unconvertible type 'string'")
+	assert.EqualError(t, err, "decode error: json: cannot unmarshal string into Go struct field SplitChangesDTO.since of type int64")
 }
 
 func TestGetSegmentNamesInUseValid(t *testing.T) {
@@ -320,6 +711,19 @@ func TestGetSegmentNamesInUseValid(t *testing.T) {
 	assert.Equal(t, segmentNames["mock-segment"], true)
 }
 
+func TestGetSegmentNamesForSplitsValid(t *testing.T) {
+	// Arrange
+	splits := splitsUsingSegments("segment-1", "segment-2")
+	splits["split-using-no-segment"] = dtos.SplitDTO{Name: "split-using-no-segment"}
+
+	// Act
+	segmentNames, usingSegmentsCount := GetSegmentNamesForSplits(splits)
+
+	// Validate that the segment names and count of splits using segments are returned
+	assert.Equal(t, segmentNames, map[string]bool{"segment-1": true, "segment-2": true})
+	assert.Equal(t, usingSegmentsCount, 2)
+}
+
 func TestGetSegmentValid(t *testing.T) {
 	// Arrange
 	handler := &mockHandler{}
@@ -328,7 +732,7 @@ func TestGetSegmentValid(t *testing.T) {
 	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
 
 	// Act
-	segment, err := result.getSegment("mock-segment")
+	segment, err := result.getSegment(context.Background(), "mock-segment")
 	var valueFiveExists bool
 	var valueTwoExists bool
 	for _, added := range segment.Added {
@@ -351,6 +755,60 @@ func TestGetSegmentValid(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestGetSegmentRequestsOnlyChangesAfterStoredTill(t *testing.T) {
+	// Arrange
+	requestedURIs := []string{}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedURIs = append(requestedURIs, r.RequestURI)
+		(&mockHandler{}).ServeHTTP(w, r)
+	}))
+	defer testServer.Close()
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+	firstSegment, _ := result.getSegment(context.Background(), "mock-segment")
+	requestedURIs = []string{}
+
+	// Act
+	segment, err := result.getSegment(context.Background(), "mock-segment")
+
+	// Validate that the second synchronization resumes from the stored till and keeps the segment keys
+	assert.Nil(t, err)
+	assert.Equal(t, requestedURIs, []string{"/segmentChanges/mock-segment?since=40"})
+	assert.Equal(t, segment, firstSegment)
+}
+
+func TestGetSegmentAppliesChangesOnStoredKeys(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("since") == "40" {
+			fmt.Fprintln(w, `{"name": "mock-segment", "added": ["mock6"], "removed": ["mock1"], "since":40, "till":50}`)
+			return
+		}
+		if r.URL.Query().Get("since") == "50" {
+			fmt.Fprintln(w, `{"name": "mock-segment", "added": [], "removed": [], "since":50, "till":50}`)
+			return
+		}
+		t.Errorf("unexpected request: %v", r.RequestURI)
+	}))
+	defer testServer.Close()
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+	result.segments.set("mock-segment", segmentState{
+		till: 40,
+		keys: map[string]bool{"mock1": true, "mock3": true},
+	})
+
+	// Act
+	segment, err := result.getSegment(context.Background(), "mock-segment")
+
+	// Validate that the changes are applied on top of the stored keys
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, segment.Added, []string{"mock3", "mock6"})
+	assert.Equal(t, segment.Since, int64(50))
+	assert.Equal(t, segment.Till, int64(50))
+	state, _ := result.segments.get("mock-segment")
+	assert.Equal(t, state.till, int64(50))
+	assert.Equal(t, state.segment, segment)
+}
+
 func TestGetSegmentReturnsDecodeError(t *testing.T) {
 	// Arrange
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -360,10 +818,10 @@ func TestGetSegmentReturnsDecodeError(t *testing.T) {
 	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
 
 	// Act
-	segment, err := result.getSegment("mock-segment-name")
+	segment, err := result.getSegment(context.Background(), "mock-segment-name")
 
 	// Validate that GetSegment function returns decode error
-	assert.EqualError(t, err, "error when decode data to segment: 1 error(s) decoding:\n\n* 'since' expected type 'int64', got unconvertible type 'string'")
+	assert.EqualError(t, err, "decode error: json: cannot unmarshal string into Go struct field SegmentChangesDTO.since of type int64")
 	assert.Equal(t, segment, dtos.SegmentChangesDTO{})
 }
 
@@ -376,7 +834,7 @@ func TestGetSegmentReturnsGetAllChangesError(t *testing.T) {
 	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
 
 	// Act
-	segment, err := result.getSegment("mock-segment-name")
+	segment, err := result.getSegment(context.Background(), "mock-segment-name")
 
 	// Validate that GetSegment function returns GetAllChanges error
 	assert.EqualError(t, err, "non-OK HTTP status: 401 Unauthorized")
@@ -401,7 +859,7 @@ func TestGetSegmentsForSplitsReturnsGetSplitError(t *testing.T) {
 	segments, usingSegmentsCount, err := result.GetSegmentsForSplits(splits)
 
 	// Validate that GetSegmentForSplits function returns error from GetSegment
-	assert.EqualError(t, err, "error when decode data to segment: 1 error(s) decoding:\n\n* 'since' expected type 'int64', got unconvertible type 'string'")
+	assert.EqualError(t, err, "decode error: json: cannot unmarshal string into Go struct field SegmentChangesDTO.since of type int64")
 	assert.Equal(t, segments, map[string]dtos.SegmentChangesDTO{})
 	assert.Equal(t, usingSegmentsCount, 0)
 }
@@ -429,3 +887,288 @@ func TestGetSegmentsForSplitsReturnsValid(t *testing.T) {
 	assert.Equal(t, segments["mock-segment"].Name, "mock-segment")
 	assert.Equal(t, usingSegmentsCount, 1)
 }
+
+func TestGetSegmentsForSplitsDropsSegmentsNoLongerUsed(t *testing.T) {
+	// Arrange
+	handler := &mockHandler{}
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+	result.segments.set("unused-segment", segmentState{till: 10, keys: map[string]bool{"mock1": true}})
+
+	// Act
+	_, _, err := result.GetSegmentsForSplits(splitsUsingSegments("mock-segment"))
+
+	// Validate that only the state of the segments used by the splits is kept
+	assert.Nil(t, err)
+	_, usedFound := result.segments.get("mock-segment")
+	_, unusedFound := result.segments.get("unused-segment")
+	assert.True(t, usedFound)
+	assert.False(t, unusedFound)
+}
+
+func TestGetSegmentsForSplitsFetchesSegmentsConcurrently(t *testing.T) {
+	// Arrange
+	var inFlight, maxInFlight int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		segmentName := r.URL.Path[len("/segmentChanges/"):]
+		if r.URL.Query().Get("since") == "-1" {
+			fmt.Fprintf(w, `{"name": "%v", "added": ["%v-key"], "removed": [], "since":-1, "till":10}`, segmentName, segmentName)
+			return
+		}
+		fmt.Fprintf(w, `{"name": "%v", "added": [], "removed": [], "since":10, "till":10}`, segmentName)
+	}))
+	defer testServer.Close()
+	splits := splitsUsingSegments("segment-1", "segment-2", "segment-3", "segment-4", "segment-5", "segment-6")
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithSegmentConcurrency(3))
+
+	// Act
+	segments, usingSegmentsCount, err := result.GetSegmentsForSplits(splits)
+
+	// Validate that all segments are merged and at most 3 were requested at the same time
+	assert.Nil(t, err)
+	assert.Equal(t, usingSegmentsCount, 6)
+	assert.Equal(t, len(segments), 6)
+	assert.Equal(t, segments["segment-4"].Added, []string{"segment-4-key"})
+	assert.True(t, maxInFlight > 1)
+	assert.True(t, maxInFlight <= 3)
+}
+
+func TestGetSegmentsForSplitsStopsAfterFirstError(t *testing.T) {
+	// Arrange
+	var mutex sync.Mutex
+	requestCount := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requestCount++
+		mutex.Unlock()
+		w.WriteHeader(401)
+	}))
+	defer testServer.Close()
+	splits := splitsUsingSegments("segment-1", "segment-2", "segment-3", "segment-4", "segment-5")
+	result := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithSegmentConcurrency(1))
+
+	// Act
+	segments, usingSegmentsCount, err := result.GetSegmentsForSplits(splits)
+
+	// Validate that the first error is returned and the remaining segments are not requested
+	assert.EqualError(t, err, "non-OK HTTP status: 401 Unauthorized")
+	assert.Equal(t, segments, map[string]dtos.SegmentChangesDTO{})
+	assert.Equal(t, usingSegmentsCount, 0)
+	assert.True(t, requestCount <= 2)
+}
+
+func TestSplitioAPIBindingImplementsSplitioContext(t *testing.T) {
+	// Validate that SplitioAPIBinding can be used as a SplitioContext
+	var binding interface{} = NewSplitioAPIBinding(mockSplitioAPIKey, "")
+	_, isSplitioContext := binding.(SplitioContext)
+	assert.True(t, isSplitioContext)
+}
+
+func TestGetSplitsContextStopsWhenContextIsDone(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer testServer.Close()
+	defer close(release)
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Act
+	start := time.Now()
+	splits, since, err := binding.GetSplitsContext(ctx)
+
+	// Validate that the hanging request is interrupted and not retried
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Nil(t, splits)
+	assert.Equal(t, since, int64(0))
+}
+
+func TestHttpGetStopsRetryingWhenContextIsDone(t *testing.T) {
+	// Arrange
+	attempts := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(503)
+	}))
+	defer testServer.Close()
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, RetryableStatusCodes: []int{503}}
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL, WithRetryPolicy(policy))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err := binding.httpGet(ctx, mockPath, mockSince, &map[string]interface{}{})
+
+	// Validate that httpGet returns the last error without waiting for the next attempt
+	assert.EqualError(t, err, "non-OK HTTP status: 503 Service Unavailable")
+	assert.Equal(t, attempts, 1)
+}
+
+func TestGetSegmentsForSplitsContextReturnsContextError(t *testing.T) {
+	// Arrange
+	handler := &mockHandler{}
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	_, usingSegmentsCount, err := binding.GetSegmentsForSplitsContext(ctx, splitsUsingSegments("segment-1", "segment-2"))
+
+	// Validate that no segment is returned when the context is already cancelled
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, usingSegmentsCount, 0)
+}
+
+func TestGetSegmentReturnsTypedHTTPError(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+
+	// Act
+	_, err := binding.getSegment(context.Background(), "mock-segment")
+
+	// Validate that the error can be inspected with errors.Is and errors.As
+	var httpErr *HTTPError
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, httpErr.StatusCode, 401)
+	assert.Equal(t, httpErr.Path, "segmentChanges/mock-segment")
+	assert.Equal(t, httpErr.Segment, "mock-segment")
+}
+
+func TestGetSplitsReturnsTypedDecodeError(t *testing.T) {
+	// Arrange
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"since":"wrong-type", "till":10}`)
+	}))
+	defer testServer.Close()
+	binding := NewSplitioAPIBinding(mockSplitioAPIKey, testServer.URL)
+
+	// Act
+	_, _, err := binding.GetSplits()
+
+	// Validate that the error can be inspected with errors.Is and errors.As
+	var decodeErr *DecodeError
+	assert.True(t, errors.Is(err, ErrDecode))
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.Equal(t, decodeErr.Path, "splitChanges")
+	assert.Equal(t, decodeErr.Segment, "")
+}
+
+// decodeThroughMap decodes a response body the way pages were decoded before being decoded
+// straight into DTOs: into a map first, then into result with mapstructure
+func decodeThroughMap(body []byte, result interface{}) error {
+	var data map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return err
+	}
+	if _, err := data["till"].(json.Number).Int64(); err != nil {
+		return err
+	}
+	mapDecoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{TagName: "json", Result: result})
+	if err != nil {
+		return err
+	}
+	return mapDecoder.Decode(data)
+}
+
+func mockSegmentChangesBody(keyCount int) []byte {
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("employee-%v@example.com", i)
+	}
+	body, _ := json.Marshal(dtos.SegmentChangesDTO{Name: "employees", Added: keys, Since: -1, Till: 10})
+	return body
+}
+
+func mockSplitChangesBody(splitCount int) []byte {
+	conditions := []dtos.ConditionDTO{}
+	_ = json.Unmarshal([]byte(mockConditions), &conditions)
+	splits := make([]dtos.SplitDTO, splitCount)
+	for i := range splits {
+		splits[i] = dtos.SplitDTO{Name: fmt.Sprintf("split-%v", i), Status: "ACTIVE", Conditions: conditions}
+	}
+	body, _ := json.Marshal(dtos.SplitChangesDTO{Splits: splits, Since: -1, Till: 10})
+	return body
+}
+
+func TestDecodeBodyMatchesDecodeThroughMap(t *testing.T) {
+	// Arrange
+	segmentBody := mockSegmentChangesBody(100)
+	splitBody := mockSplitChangesBody(10)
+	var segment, segmentThroughMap dtos.SegmentChangesDTO
+	var splitChanges, splitChangesThroughMap dtos.SplitChangesDTO
+
+	// Act
+	segmentErr := decodeBody(bytes.NewReader(segmentBody), &segment)
+	splitErr := decodeBody(bytes.NewReader(splitBody), &splitChanges)
+	_ = decodeThroughMap(segmentBody, &segmentThroughMap)
+	_ = decodeThroughMap(splitBody, &splitChangesThroughMap)
+
+	// Validate that decoding straight into DTOs gives the same result as decoding through a map
+	assert.Nil(t, segmentErr)
+	assert.Nil(t, splitErr)
+	assert.Equal(t, segment, segmentThroughMap)
+	assert.Equal(t, splitChanges, splitChangesThroughMap)
+}
+
+func BenchmarkDecodeBodySegmentChanges(b *testing.B) {
+	body := mockSegmentChangesBody(50000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var segment dtos.SegmentChangesDTO
+		_ = decodeBody(bytes.NewReader(body), &segment)
+	}
+}
+
+func BenchmarkDecodeThroughMapSegmentChanges(b *testing.B) {
+	body := mockSegmentChangesBody(50000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var segment dtos.SegmentChangesDTO
+		_ = decodeThroughMap(body, &segment)
+	}
+}
+
+func BenchmarkDecodeBodySplitChanges(b *testing.B) {
+	body := mockSplitChangesBody(400)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var splitChanges dtos.SplitChangesDTO
+		_ = decodeBody(bytes.NewReader(body), &splitChanges)
+	}
+}
+
+func BenchmarkDecodeThroughMapSplitChanges(b *testing.B) {
+	body := mockSplitChangesBody(400)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var splitChanges dtos.SplitChangesDTO
+		_ = decodeThroughMap(body, &splitChanges)
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const segmentChangesPathPrefix = "segmentChanges/"
+
+var (
+	// ErrUnauthorized is matched by the errors of requests rejected because the SDK key is invalid or revoked
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited is matched by the errors of requests rejected because of rate limiting
+	ErrRateLimited = errors.New("rate limited")
+	// ErrServerError is matched by the errors of requests failing with a 5xx status
+	ErrServerError = errors.New("server error")
+	// ErrDecode is matched by the errors of responses that could not be decoded
+	ErrDecode = errors.New("decode error")
+	// ErrPaginationLimitExceeded is matched by the errors of synchronizations needing more than the maximum number of requests
+	ErrPaginationLimitExceeded = errors.New("pagination limit exceeded")
+	// ErrInvalidTill is matched by the errors of responses whose till is older than the since requested
+	ErrInvalidTill = errors.New("invalid till")
+)
+
+// HTTPError is returned when Split.io responds with a non-OK status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Path       string
+	// Segment is the name of the segment requested, empty when requesting splits
+	Segment string
+}
+
+// Error returns the error message of an HTTPError
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("non-OK HTTP status: %s", err.Status)
+}
+
+// Is reports whether the HTTPError matches ErrUnauthorized or ErrServerError
+func (err *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return err.StatusCode == http.StatusUnauthorized || err.StatusCode == http.StatusForbidden
+	case ErrServerError:
+		return err.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// DecodeError is returned when a response from Split.io could not be decoded
+type DecodeError struct {
+	Path string
+	// Segment is the name of the segment requested, empty when requesting splits
+	Segment string
+	Err     error
+}
+
+// Error returns the error message of a DecodeError
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("decode error: %s", err.Err)
+}
+
+// Unwrap returns the underlying decoding error
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
+
+// Is reports whether the DecodeError matches ErrDecode
+func (err *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+// PaginationError is returned when the changes are still not all received after the maximum number of pages of changes.
+// No partial result is returned along with it, so a truncated set of splits or segment keys is never used.
+type PaginationError struct {
+	Path string
+	// Segment is the name of the segment requested, empty when requesting splits
+	Segment       string
+	MaxRequestNum int
+	// Since is the till received in the last response
+	Since int64
+}
+
+// Error returns the error message of a PaginationError
+func (err *PaginationError) Error() string {
+	return fmt.Sprintf("changes of %s not fully received after %d pages of changes, reached since %d", err.Path, err.MaxRequestNum, err.Since)
+}
+
+// Is reports whether the PaginationError matches ErrPaginationLimitExceeded
+func (err *PaginationError) Is(target error) bool {
+	return target == ErrPaginationLimitExceeded
+}
+
+// InvalidTillError is returned when Split.io responds with a till older than the since requested
+type InvalidTillError struct {
+	Path string
+	// Segment is the name of the segment requested, empty when requesting splits
+	Segment string
+	Since   int64
+	Till    int64
+}
+
+// Error returns the error message of an InvalidTillError
+func (err *InvalidTillError) Error() string {
+	return fmt.Sprintf("invalid till for %s: till %d is older than since %d", err.Path, err.Till, err.Since)
+}
+
+// Is reports whether the InvalidTillError matches ErrInvalidTill
+func (err *InvalidTillError) Is(target error) bool {
+	return target == ErrInvalidTill
+}
+
+// RateLimitError is returned when Split.io rejects a request because of rate limiting,
+// either with a 429 response or with a 503 response carrying a Retry-After header
+type RateLimitError struct {
+	StatusCode int
+	Status     string
+	Path       string
+	// Segment is the name of the segment requested, empty when requesting splits
+	Segment string
+	// RetryAfter is how long Split.io asked to wait before the next request, zero when not specified
+	RetryAfter time.Duration
+}
+
+// Error returns the error message of a RateLimitError
+func (err *RateLimitError) Error() string {
+	if err.RetryAfter > 0 {
+		return fmt.Sprintf("non-OK HTTP status: %s, retry after %s", err.Status, err.RetryAfter)
+	}
+	return fmt.Sprintf("non-OK HTTP status: %s", err.Status)
+}
+
+// Is reports whether the RateLimitError matches ErrRateLimited
+func (err *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// newRateLimitError returns a RateLimitError when the response status and headers indicate
+// that the request was rate limited, or nil otherwise
+func newRateLimitError(path string, statusCode int, status string, header http.Header, now time.Time) *RateLimitError {
+	retryAfter, hasRetryAfter := parseRetryAfter(header.Get("Retry-After"), now)
+	if statusCode != http.StatusTooManyRequests && !(statusCode == http.StatusServiceUnavailable && hasRetryAfter) {
+		return nil
+	}
+	return &RateLimitError{
+		StatusCode: statusCode,
+		Status:     status,
+		Path:       path,
+		Segment:    segmentNameFromPath(path),
+		RetryAfter: retryAfter,
+	}
+}
+
+// segmentNameFromPath returns the name of the segment requested by path, or an empty string
+func segmentNameFromPath(path string) string {
+	if strings.HasPrefix(path, segmentChangesPathPrefix) {
+		return strings.TrimPrefix(path, segmentChangesPathPrefix)
+	}
+	return ""
+}
+
+// parseRetryAfter parses a Retry-After header value, either a number of seconds or an HTTP date,
+// and returns the duration to wait from now along with whether the value was valid
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	retryAfter := date.Sub(now)
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return retryAfter, true
+}
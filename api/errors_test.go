@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var mockNow = time.Date(2020, time.August, 14, 12, 0, 0, 0, time.UTC)
+
+func TestParseRetryAfterSeconds(t *testing.T) {
+	// Act
+	retryAfter, valid := parseRetryAfter("120", mockNow)
+
+	// Validate that a number of seconds is parsed
+	assert.True(t, valid)
+	assert.Equal(t, retryAfter, 2*time.Minute)
+}
+
+func TestParseRetryAfterHTTPDate(t *testing.T) {
+	// Act
+	retryAfter, valid := parseRetryAfter("Fri, 14 Aug 2020 12:00:30 GMT", mockNow)
+	pastRetryAfter, pastValid := parseRetryAfter("Fri, 14 Aug 2020 11:00:00 GMT", mockNow)
+
+	// Validate that an HTTP date is parsed relative to now and never negative
+	assert.True(t, valid)
+	assert.Equal(t, retryAfter, 30*time.Second)
+	assert.True(t, pastValid)
+	assert.Equal(t, pastRetryAfter, time.Duration(0))
+}
+
+func TestParseRetryAfterInvalid(t *testing.T) {
+	for _, value := range []string{"", "-1", "soon"} {
+		// Act
+		retryAfter, valid := parseRetryAfter(value, mockNow)
+
+		// Validate that invalid values are rejected
+		assert.False(t, valid)
+		assert.Equal(t, retryAfter, time.Duration(0))
+	}
+}
+
+func TestNewRateLimitErrorTooManyRequests(t *testing.T) {
+	// Arrange
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+
+	// Act
+	err := newRateLimitError(mockPath, 429, "429 Too Many Requests", header, mockNow)
+	errWithoutRetryAfter := newRateLimitError(mockPath, 429, "429 Too Many Requests", http.Header{}, mockNow)
+
+	// Validate that a 429 response is a rate limit error with or without Retry-After
+	assert.Equal(t, err, &RateLimitError{StatusCode: 429, Status: "429 Too Many Requests", Path: mockPath, RetryAfter: 30 * time.Second})
+	assert.EqualError(t, err, "non-OK HTTP status: 429 Too Many Requests, retry after 30s")
+	assert.EqualError(t, errWithoutRetryAfter, "non-OK HTTP status: 429 Too Many Requests")
+}
+
+func TestNewRateLimitErrorServiceUnavailable(t *testing.T) {
+	// Arrange
+	header := http.Header{}
+	header.Set("Retry-After", "10")
+
+	// Act
+	err := newRateLimitError(mockPath, 503, "503 Service Unavailable", header, mockNow)
+	errWithoutRetryAfter := newRateLimitError(mockPath, 503, "503 Service Unavailable", http.Header{}, mockNow)
+
+	// Validate that a 503 response is a rate limit error only when it has a Retry-After header
+	assert.Equal(t, err.RetryAfter, 10*time.Second)
+	assert.Nil(t, errWithoutRetryAfter)
+}
+
+func TestNewRateLimitErrorOtherStatus(t *testing.T) {
+	// Arrange
+	header := http.Header{}
+	header.Set("Retry-After", "10")
+
+	// Act
+	err := newRateLimitError(mockPath, 500, "500 Internal Server Error", header, mockNow)
+
+	// Validate that other responses are not rate limit errors
+	assert.Nil(t, err)
+}
+
+func TestHTTPErrorIs(t *testing.T) {
+	// Arrange
+	unauthorizedErr := &HTTPError{StatusCode: 401, Status: "401 Unauthorized"}
+	forbiddenErr := &HTTPError{StatusCode: 403, Status: "403 Forbidden"}
+	serverErr := &HTTPError{StatusCode: 502, Status: "502 Bad Gateway"}
+	notFoundErr := &HTTPError{StatusCode: 404, Status: "404 Not Found"}
+
+	// Validate that HTTPError matches the sentinel errors according to its status code, even when wrapped
+	assert.True(t, errors.Is(fmt.Errorf("wrapped: %w", unauthorizedErr), ErrUnauthorized))
+	assert.True(t, errors.Is(forbiddenErr, ErrUnauthorized))
+	assert.False(t, errors.Is(unauthorizedErr, ErrServerError))
+	assert.True(t, errors.Is(serverErr, ErrServerError))
+	assert.False(t, errors.Is(serverErr, ErrUnauthorized))
+	assert.False(t, errors.Is(notFoundErr, ErrUnauthorized))
+	assert.False(t, errors.Is(notFoundErr, ErrServerError))
+	assert.EqualError(t, serverErr, "non-OK HTTP status: 502 Bad Gateway")
+}
+
+func TestRateLimitErrorIs(t *testing.T) {
+	// Arrange
+	err := &RateLimitError{StatusCode: 429, Status: "429 Too Many Requests"}
+
+	// Validate that RateLimitError matches ErrRateLimited only
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.False(t, errors.Is(err, ErrServerError))
+}
+
+func TestDecodeError(t *testing.T) {
+	// Arrange
+	cause := errors.New("unexpected EOF")
+	responseErr := &DecodeError{Path: mockPath, Err: cause}
+	segmentErr := &DecodeError{Path: "segmentChanges/mock-segment", Segment: "mock-segment", Err: cause}
+
+	// Validate that DecodeError matches ErrDecode and unwraps its cause
+	assert.True(t, errors.Is(responseErr, ErrDecode))
+	assert.True(t, errors.Is(segmentErr, cause))
+	assert.False(t, errors.Is(responseErr, ErrUnauthorized))
+	assert.EqualError(t, responseErr, "decode error: unexpected EOF")
+}
+
+func TestSegmentNameFromPath(t *testing.T) {
+	// Validate that the segment name is extracted from segment paths only
+	assert.Equal(t, segmentNameFromPath("segmentChanges/mock-segment"), "mock-segment")
+	assert.Equal(t, segmentNameFromPath("splitChanges"), "")
+}
+
+func TestPaginationErrorIs(t *testing.T) {
+	// Arrange
+	err := &PaginationError{Path: "splitChanges", MaxRequestNum: 100, Since: 20}
+
+	// Validate that PaginationError matches ErrPaginationLimitExceeded only
+	assert.True(t, errors.Is(err, ErrPaginationLimitExceeded))
+	assert.False(t, errors.Is(err, ErrDecode))
+}
+
+func TestInvalidTillErrorIs(t *testing.T) {
+	// Arrange
+	err := &InvalidTillError{Path: "splitChanges", Since: 20, Till: 10}
+
+	// Validate that InvalidTillError matches ErrInvalidTill only
+	assert.True(t, errors.Is(err, ErrInvalidTill))
+	assert.False(t, errors.Is(err, ErrPaginationLimitExceeded))
+}
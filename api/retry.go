@@ -0,0 +1,78 @@
+package api
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// maxRetryDelay caps the delay between two attempts when MaxDelay is zero, so that doubling the delay
+// and applying the jitter cannot overflow
+const maxRetryDelay = time.Duration(math.MaxInt64 / 4)
+
+// RetryPolicy controls how requests to the Split.io API are retried when they fail
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made for a request, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled on every following retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, no cap is applied when zero
+	MaxDelay time.Duration
+	// Jitter is the fraction, between 0 and 1, by which each delay is randomly increased or decreased.
+	// It is clamped to this range by WithRetryPolicy.
+	Jitter float64
+	// RetryableStatusCodes are the HTTP status codes for which a request is retried.
+	// Requests failing before a response is received are always retried.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy returns the RetryPolicy used when none is provided
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Jitter:      0.2,
+		RetryableStatusCodes: []int{
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// isRetryableStatus returns whether a response with statusCode should be retried
+func (policy RetryPolicy) isRetryableStatus(statusCode int) bool {
+	for _, retryableStatusCode := range policy.RetryableStatusCodes {
+		if statusCode == retryableStatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait after the given failed attempt, attempts starting at 1
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	maxDelay := maxRetryDelay
+	if policy.MaxDelay > 0 && policy.MaxDelay < maxDelay {
+		maxDelay = policy.MaxDelay
+	}
+	delay := policy.BaseDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if policy.Jitter > 0 {
+		delay += time.Duration(float64(delay) * policy.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+// clampJitter returns jitter limited to the range between 0 and 1
+func clampJitter(jitter float64) float64 {
+	return math.Max(0, math.Min(jitter, 1))
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyIsRetryableStatus(t *testing.T) {
+	// Arrange
+	policy := DefaultRetryPolicy()
+
+	// Validate that only the configured status codes are retryable
+	assert.True(t, policy.isRetryableStatus(http.StatusBadGateway))
+	assert.True(t, policy.isRetryableStatus(http.StatusServiceUnavailable))
+	assert.False(t, policy.isRetryableStatus(http.StatusNotFound))
+	assert.False(t, policy.isRetryableStatus(http.StatusUnauthorized))
+}
+
+func TestRetryPolicyDelayGrowsExponentially(t *testing.T) {
+	// Arrange
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	// Validate that the delay doubles on every attempt until it reaches MaxDelay
+	assert.Equal(t, policy.delay(1), 100*time.Millisecond)
+	assert.Equal(t, policy.delay(2), 200*time.Millisecond)
+	assert.Equal(t, policy.delay(4), 800*time.Millisecond)
+	assert.Equal(t, policy.delay(5), time.Second)
+	assert.Equal(t, policy.delay(100), time.Second)
+}
+
+func TestRetryPolicyDelayWithoutMaxDelay(t *testing.T) {
+	// Arrange
+	policy := RetryPolicy{BaseDelay: time.Second}
+
+	// Validate that the delay is not capped when MaxDelay is zero
+	assert.Equal(t, policy.delay(5), 16*time.Second)
+}
+
+func TestRetryPolicyDelayAppliesJitter(t *testing.T) {
+	// Arrange
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, Jitter: 0.5}
+
+	// Validate that the delay stays within the jitter bounds
+	for i := 0; i < 100; i++ {
+		delay := policy.delay(2)
+		assert.True(t, delay >= time.Second)
+		assert.True(t, delay <= 3*time.Second)
+	}
+}
+
+func TestRetryPolicyDelayDoesNotOverflowWithoutMaxDelay(t *testing.T) {
+	// Arrange
+	policy := RetryPolicy{BaseDelay: time.Second, Jitter: 1}
+
+	// Validate that the delay stays positive and capped for large attempt counts
+	for _, attempt := range []int{40, 64, 100, 1000} {
+		delay := policy.delay(attempt)
+		assert.True(t, delay >= 0)
+		assert.True(t, delay <= 2*maxRetryDelay)
+	}
+}
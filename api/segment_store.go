@@ -0,0 +1,57 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/splitio/go-split-commons/dtos"
+)
+
+// segmentStore keeps the last synchronized state of each segment so that
+// only the changes made after its till need to be requested from Split.io
+type segmentStore struct {
+	mutex    sync.RWMutex
+	segments map[string]segmentState
+}
+
+// segmentState contains the keys of a segment as of till, along with the segment
+// in the format returned to callers. keys must not be modified once stored.
+type segmentState struct {
+	till    int64
+	keys    map[string]bool
+	segment dtos.SegmentChangesDTO
+}
+
+// newSegmentStore returns an empty segmentStore
+func newSegmentStore() *segmentStore {
+	return &segmentStore{segments: map[string]segmentState{}}
+}
+
+// get returns the stored state of a segment and whether it was found
+func (store *segmentStore) get(segmentName string) (segmentState, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	state, found := store.segments[segmentName]
+	return state, found
+}
+
+// set stores the state of a segment unless a more recent state is already stored
+func (store *segmentStore) set(segmentName string, state segmentState) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	current, found := store.segments[segmentName]
+	if found && current.till > state.till {
+		return
+	}
+	store.segments[segmentName] = state
+}
+
+// prune removes the stored state of the segments not in segmentNames, which are no longer used by any split
+func (store *segmentStore) prune(segmentNames map[string]bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for segmentName := range store.segments {
+		if !segmentNames[segmentName] {
+			delete(store.segments, segmentName)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/splitio/go-split-commons/dtos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentStoreGetReturnsNotFound(t *testing.T) {
+	// Arrange
+	store := newSegmentStore()
+
+	// Act
+	state, found := store.get("mock-segment")
+
+	// Validate that an unknown segment is not found
+	assert.False(t, found)
+	assert.Equal(t, state, segmentState{})
+}
+
+func TestSegmentStoreSetValid(t *testing.T) {
+	// Arrange
+	store := newSegmentStore()
+	segment := dtos.SegmentChangesDTO{Name: "mock-segment", Added: []string{"mock1"}, Since: 10, Till: 10}
+	state := segmentState{till: 10, keys: map[string]bool{"mock1": true}, segment: segment}
+
+	// Act
+	store.set("mock-segment", state)
+	result, found := store.get("mock-segment")
+
+	// Validate that the stored state is returned
+	assert.True(t, found)
+	assert.Equal(t, result, state)
+}
+
+func TestSegmentStoreSetKeepsMoreRecentState(t *testing.T) {
+	// Arrange
+	store := newSegmentStore()
+	recentState := segmentState{till: 20, keys: map[string]bool{"mock2": true}}
+	staleState := segmentState{till: 10, keys: map[string]bool{"mock1": true}}
+
+	// Act
+	store.set("mock-segment", recentState)
+	store.set("mock-segment", staleState)
+	result, _ := store.get("mock-segment")
+
+	// Validate that a state with an older till does not overwrite a more recent one
+	assert.Equal(t, result, recentState)
+}
+
+func TestSegmentStorePruneRemovesUnusedSegments(t *testing.T) {
+	// Arrange
+	store := newSegmentStore()
+	usedState := segmentState{till: 10, keys: map[string]bool{"mock1": true}}
+	store.set("used-segment", usedState)
+	store.set("unused-segment", segmentState{till: 10, keys: map[string]bool{"mock2": true}})
+
+	// Act
+	store.prune(map[string]bool{"used-segment": true})
+	usedResult, usedFound := store.get("used-segment")
+	_, unusedFound := store.get("unused-segment")
+
+	// Validate that only the state of the segments still in use is kept
+	assert.True(t, usedFound)
+	assert.Equal(t, usedResult, usedState)
+	assert.False(t, unusedFound)
+}
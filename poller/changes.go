@@ -0,0 +1,206 @@
+package poller
+
+import (
+	"sort"
+
+	"github.com/splitio/go-split-commons/dtos"
+)
+
+// ChangeEvent describes the changes between the previous and the current SplitData of a Poller
+type ChangeEvent struct {
+	PreviousSince    int64
+	Since            int64
+	AddedSplits      []string
+	RemovedSplits    []string
+	ModifiedSplits   []SplitChange
+	AddedSegments    []string
+	RemovedSegments  []string
+	ModifiedSegments []SegmentChange
+}
+
+// SplitChange describes the changes of a split present in both the previous and the current SplitData
+type SplitChange struct {
+	Name                     string
+	PreviousChangeNumber     int64
+	ChangeNumber             int64
+	PreviousStatus           string
+	Status                   string
+	PreviousKilled           bool
+	Killed                   bool
+	PreviousDefaultTreatment string
+	DefaultTreatment         string
+}
+
+// SegmentChange describes the keys added to and removed from a segment present in both
+// the previous and the current SplitData
+type SegmentChange struct {
+	Name        string
+	AddedKeys   int
+	RemovedKeys int
+}
+
+// IsEmpty returns whether no split or segment changed
+func (event ChangeEvent) IsEmpty() bool {
+	return len(event.AddedSplits) == 0 && len(event.RemovedSplits) == 0 && len(event.ModifiedSplits) == 0 &&
+		len(event.AddedSegments) == 0 && len(event.RemovedSegments) == 0 && len(event.ModifiedSegments) == 0
+}
+
+// subscriber is a function subscribed to the changes of a Poller
+type subscriber struct {
+	id      uint64
+	handler func(ChangeEvent)
+}
+
+// Subscribe registers handler to be called with the changes of each poll that changed splits or segments,
+// and returns a function unregistering it. Handlers are called once the cache is updated, one at a time,
+// in the order they subscribed, from a goroutine that is not polling, so a slow handler never delays polling.
+// The changes of the polls made while handlers are running are merged into a single ChangeEvent.
+// Handlers may call Stop.
+func (poller *Poller) Subscribe(handler func(ChangeEvent)) func() {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	poller.lastSubscriberID++
+	id := poller.lastSubscriberID
+	poller.subscribers = append(poller.subscribers, subscriber{id: id, handler: handler})
+	return func() {
+		poller.mutex.Lock()
+		defer poller.mutex.Unlock()
+		for index, subscriber := range poller.subscribers {
+			if subscriber.id == id {
+				poller.subscribers = append(poller.subscribers[:index:index], poller.subscribers[index+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notifySubscribers makes the subscribers be called with the changes between previous and current, if any.
+// While subscribers are being called, only the latest SplitData is kept, so that the changes of the following
+// polls are merged into one event and a slow subscriber holds on to at most two SplitData.
+func (poller *Poller) notifySubscribers(previous, current SplitData) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if len(poller.subscribers) == 0 {
+		return
+	}
+	poller.pendingChanges = &current
+	if !poller.notifyingChanges {
+		poller.notifyingChanges = true
+		poller.notifiedSplitData = previous
+		go poller.callSubscribers()
+	}
+}
+
+// callSubscribers calls the subscribers with the changes between the last notified and the pending SplitData,
+// computed off the polling goroutine, until no changes are pending
+func (poller *Poller) callSubscribers() {
+	for {
+		poller.mutex.Lock()
+		if poller.pendingChanges == nil {
+			poller.notifyingChanges = false
+			poller.notifiedSplitData = SplitData{}
+			poller.mutex.Unlock()
+			return
+		}
+		previous := poller.notifiedSplitData
+		current := *poller.pendingChanges
+		poller.pendingChanges = nil
+		poller.notifiedSplitData = current
+		subscribers := poller.subscribers
+		poller.mutex.Unlock()
+
+		event := diffSplitData(previous, current)
+		if event.IsEmpty() {
+			continue
+		}
+		for _, subscriber := range subscribers {
+			subscriber.handler(event)
+		}
+	}
+}
+
+// diffSplitData returns the changes between previous and current, names are sorted.
+// The keys of a segment are only compared when its till changed.
+func diffSplitData(previous, current SplitData) ChangeEvent {
+	event := ChangeEvent{PreviousSince: previous.Since, Since: current.Since}
+
+	for name, split := range current.Splits {
+		previousSplit, found := previous.Splits[name]
+		if !found {
+			event.AddedSplits = append(event.AddedSplits, name)
+			continue
+		}
+		if split.ChangeNumber != previousSplit.ChangeNumber || split.Status != previousSplit.Status ||
+			split.Killed != previousSplit.Killed || split.DefaultTreatment != previousSplit.DefaultTreatment {
+			event.ModifiedSplits = append(event.ModifiedSplits, SplitChange{
+				Name:                     name,
+				PreviousChangeNumber:     previousSplit.ChangeNumber,
+				ChangeNumber:             split.ChangeNumber,
+				PreviousStatus:           previousSplit.Status,
+				Status:                   split.Status,
+				PreviousKilled:           previousSplit.Killed,
+				Killed:                   split.Killed,
+				PreviousDefaultTreatment: previousSplit.DefaultTreatment,
+				DefaultTreatment:         split.DefaultTreatment,
+			})
+		}
+	}
+	for name := range previous.Splits {
+		if _, found := current.Splits[name]; !found {
+			event.RemovedSplits = append(event.RemovedSplits, name)
+		}
+	}
+
+	for name, segment := range current.Segments {
+		previousSegment, found := previous.Segments[name]
+		if !found {
+			event.AddedSegments = append(event.AddedSegments, name)
+			continue
+		}
+		// A segment whose till did not change has the same keys, so its keys are not compared
+		if segment.Till == previousSegment.Till {
+			continue
+		}
+		keys := segmentKeys(segment)
+		previousKeys := segmentKeys(previousSegment)
+		change := SegmentChange{Name: name}
+		for key := range keys {
+			if !previousKeys[key] {
+				change.AddedKeys++
+			}
+		}
+		for key := range previousKeys {
+			if !keys[key] {
+				change.RemovedKeys++
+			}
+		}
+		if change.AddedKeys > 0 || change.RemovedKeys > 0 {
+			event.ModifiedSegments = append(event.ModifiedSegments, change)
+		}
+	}
+	for name := range previous.Segments {
+		if _, found := current.Segments[name]; !found {
+			event.RemovedSegments = append(event.RemovedSegments, name)
+		}
+	}
+
+	sort.Strings(event.AddedSplits)
+	sort.Strings(event.RemovedSplits)
+	sort.Slice(event.ModifiedSplits, func(i, j int) bool { return event.ModifiedSplits[i].Name < event.ModifiedSplits[j].Name })
+	sort.Strings(event.AddedSegments)
+	sort.Strings(event.RemovedSegments)
+	sort.Slice(event.ModifiedSegments, func(i, j int) bool { return event.ModifiedSegments[i].Name < event.ModifiedSegments[j].Name })
+	return event
+}
+
+// segmentKeys returns the keys of segment, the keys added that were not removed
+func segmentKeys(segment dtos.SegmentChangesDTO) map[string]bool {
+	keys := make(map[string]bool, len(segment.Added))
+	for _, key := range segment.Added {
+		keys[key] = true
+	}
+	for _, key := range segment.Removed {
+		delete(keys, key)
+	}
+	return keys
+}
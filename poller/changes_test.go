@@ -0,0 +1,193 @@
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/splitio/go-split-commons/dtos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSplitDataValid(t *testing.T) {
+	// Arrange
+	previous := SplitData{
+		Since: 1,
+		Splits: map[string]dtos.SplitDTO{
+			"mock-split-removed":   {Name: "mock-split-removed"},
+			"mock-split-killed":    {Name: "mock-split-killed", ChangeNumber: 1, Status: "ACTIVE", DefaultTreatment: "on"},
+			"mock-split-unchanged": {Name: "mock-split-unchanged", ChangeNumber: 1},
+		},
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"mock-segment-removed":   {Name: "mock-segment-removed"},
+			"mock-segment-modified":  {Name: "mock-segment-modified", Added: []string{"foo", "bar", "baz"}, Till: 1},
+			"mock-segment-unchanged": {Name: "mock-segment-unchanged", Added: []string{"foo"}},
+		},
+	}
+	current := SplitData{
+		Since: 2,
+		Splits: map[string]dtos.SplitDTO{
+			"mock-split-added":     {Name: "mock-split-added"},
+			"mock-split-killed":    {Name: "mock-split-killed", ChangeNumber: 2, Status: "ACTIVE", Killed: true, DefaultTreatment: "off"},
+			"mock-split-unchanged": {Name: "mock-split-unchanged", ChangeNumber: 1},
+		},
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"mock-segment-added":     {Name: "mock-segment-added"},
+			"mock-segment-modified":  {Name: "mock-segment-modified", Added: []string{"foo", "qux", "quux"}, Till: 2},
+			"mock-segment-unchanged": {Name: "mock-segment-unchanged", Added: []string{"foo"}},
+		},
+	}
+
+	// Act
+	result := diffSplitData(previous, current)
+
+	// Validate
+	assert.Equal(t, result, ChangeEvent{
+		PreviousSince: 1,
+		Since:         2,
+		AddedSplits:   []string{"mock-split-added"},
+		RemovedSplits: []string{"mock-split-removed"},
+		ModifiedSplits: []SplitChange{{
+			Name:                     "mock-split-killed",
+			PreviousChangeNumber:     1,
+			ChangeNumber:             2,
+			PreviousStatus:           "ACTIVE",
+			Status:                   "ACTIVE",
+			Killed:                   true,
+			PreviousDefaultTreatment: "on",
+			DefaultTreatment:         "off",
+		}},
+		AddedSegments:    []string{"mock-segment-added"},
+		RemovedSegments:  []string{"mock-segment-removed"},
+		ModifiedSegments: []SegmentChange{{Name: "mock-segment-modified", AddedKeys: 2, RemovedKeys: 2}},
+	})
+	assert.False(t, result.IsEmpty())
+}
+
+func TestDiffSplitDataWithoutChangesIsEmpty(t *testing.T) {
+	// Arrange
+	splitData := SplitData{
+		Since:    1,
+		Splits:   mockMultipleSplits,
+		Segments: mockSegments,
+	}
+	updatedSplitData := splitData
+	updatedSplitData.Since = 2
+
+	// Act
+	result := diffSplitData(splitData, updatedSplitData)
+
+	// Validate
+	assert.True(t, result.IsEmpty())
+}
+
+func TestDiffSplitDataSkipsSegmentsWithUnchangedTill(t *testing.T) {
+	// Arrange
+	previous := SplitData{
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"mock-segment": {Name: "mock-segment", Added: []string{"foo"}, Till: 1},
+		},
+	}
+	current := SplitData{
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"mock-segment": {Name: "mock-segment", Added: []string{"bar"}, Till: 1},
+		},
+	}
+
+	// Act
+	result := diffSplitData(previous, current)
+
+	// Validate that the keys of a segment are not compared when its till did not change
+	assert.True(t, result.IsEmpty())
+}
+
+func TestSubscribeReceivesChanges(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, false, &mockIncrementalSplitio{mockSplitio: mockSplitio{getSplitValid: true}})
+	received := make(chan ChangeEvent, 2)
+	poller.Subscribe(func(event ChangeEvent) {
+		received <- event
+	})
+
+	// Act
+	poller.poll(context.Background())
+	firstEvent := <-received
+	poller.poll(context.Background())
+
+	// Validate that each poll notified the split it added, in order
+	events := []ChangeEvent{firstEvent, <-received}
+	assert.Equal(t, events[0].Since, int64(1))
+	assert.Equal(t, events[0].AddedSplits, []string{"mock-split", "mock-split-2", "mock-split-3"})
+	assert.Equal(t, events[1].PreviousSince, int64(1))
+	assert.Equal(t, events[1].Since, int64(11))
+	assert.Equal(t, events[1].AddedSplits, []string{"mock-split-since-1"})
+}
+
+func TestSubscribeMergesChangesWhileHandlerIsRunning(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, false, &mockIncrementalSplitio{mockSplitio: mockSplitio{getSplitValid: true}})
+	received := make(chan ChangeEvent, 3)
+	release := make(chan bool)
+	poller.Subscribe(func(event ChangeEvent) {
+		received <- event
+		<-release
+	})
+	poller.poll(context.Background())
+	firstEvent := <-received
+
+	// Act
+	poller.poll(context.Background())
+	poller.poll(context.Background())
+	release <- true
+	secondEvent := <-received
+	release <- true
+
+	// Validate that the polls made while the handler was running are notified as one event
+	assert.Equal(t, firstEvent.Since, int64(1))
+	assert.Equal(t, secondEvent.PreviousSince, int64(1))
+	assert.Equal(t, secondEvent.Since, int64(21))
+	assert.Equal(t, secondEvent.AddedSplits, []string{"mock-split-since-1", "mock-split-since-11"})
+	assert.Len(t, received, 0)
+}
+
+func TestUnsubscribeStopsNotifications(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, false, &mockIncrementalSplitio{mockSplitio: mockSplitio{getSplitValid: true}})
+	firstEvents := make(chan ChangeEvent, 2)
+	secondEvents := make(chan ChangeEvent, 2)
+	unsubscribe := poller.Subscribe(func(event ChangeEvent) { firstEvents <- event })
+	poller.Subscribe(func(event ChangeEvent) { secondEvents <- event })
+	poller.poll(context.Background())
+	<-secondEvents
+
+	// Act
+	unsubscribe()
+	unsubscribe()
+	poller.poll(context.Background())
+	<-secondEvents
+
+	// Validate
+	assert.Len(t, firstEvents, 1)
+	assert.Len(t, secondEvents, 0)
+}
+
+func TestStopFromSubscribedHandler(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, false, &mockSplitio{getSplitValid: true})
+	stopped := make(chan bool)
+	poller.Subscribe(func(event ChangeEvent) {
+		poller.Stop()
+		stopped <- true
+	})
+
+	// Act
+	poller.Start()
+
+	// Validate that a handler can stop the poller without waiting for itself
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop called from a handler did not return")
+	}
+	assert.Equal(t, poller.State(), StateStopped)
+}
@@ -0,0 +1,185 @@
+package poller
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godaddy/split-go-serializer/v3/api"
+	"github.com/splitio/go-split-commons/dtos"
+)
+
+// fragments contains the serialized splits and segments of a SplitData. Each fragment is an entry of the
+// splitsData or segmentsData JSON objects, so serialized data is assembled by concatenating fragments.
+type fragments struct {
+	splits       map[string]splitFragment
+	splitNames   []string // sorted
+	segments     map[string]segmentFragment
+	segmentNames []string // sorted
+}
+
+// splitFragment is a serialized split, generated for the split changeNumber
+type splitFragment struct {
+	split        dtos.SplitDTO
+	changeNumber int64
+	entry        string
+}
+
+// segmentFragment is a serialized segment, generated for the segment till
+type segmentFragment struct {
+	till  int64
+	entry string
+}
+
+// newFragments serializes the splits and segments of splitData, reusing the fragments of previous,
+// if any, for the splits with the same changeNumber and the segments with the same till
+func newFragments(splitData SplitData, previous *fragments) *fragments {
+	if previous == nil {
+		previous = &fragments{}
+	}
+	result := &fragments{
+		splits:   make(map[string]splitFragment, len(splitData.Splits)),
+		segments: make(map[string]segmentFragment, len(splitData.Segments)),
+	}
+	for _, split := range splitData.Splits {
+		fragment, found := previous.splits[split.Name]
+		if !found || fragment.changeNumber != split.ChangeNumber {
+			marshalledSplit, _ := json.Marshal(split)
+			fragment = splitFragment{changeNumber: split.ChangeNumber, entry: marshalEntry(split.Name, marshalledSplit)}
+		}
+		fragment.split = split
+		result.splits[split.Name] = fragment
+	}
+	for _, segment := range splitData.Segments {
+		fragment, found := previous.segments[segment.Name]
+		if !found || fragment.till != segment.Till {
+			marshalledSegment, _ := json.Marshal(segment)
+			fragment = segmentFragment{till: segment.Till, entry: marshalEntry(segment.Name, marshalledSegment)}
+		}
+		result.segments[segment.Name] = fragment
+	}
+	result.splitNames = make([]string, 0, len(result.splits))
+	for name := range result.splits {
+		result.splitNames = append(result.splitNames, name)
+	}
+	sort.Strings(result.splitNames)
+	result.segmentNames = make([]string, 0, len(result.segments))
+	for name := range result.segments {
+		result.segmentNames = append(result.segmentNames, name)
+	}
+	sort.Strings(result.segmentNames)
+	return result
+}
+
+// loggingScriptParts are the parts of formattedLoggingScript around the values of the serialized data
+var loggingScriptParts = strings.Split(formattedLoggingScript, "%v")
+
+// serialize assembles the script tag of splitData from the fragments, only including the splits
+// named in the sorted splitNames, and the segments they use when serializeSegments, if not empty
+func (fragments *fragments) serialize(splitData SplitData, splitNames []string, serializeSegments bool) string {
+	var builder strings.Builder
+	fragments.write(&builder, splitData, splitNames, serializeSegments)
+	return builder.String()
+}
+
+// write assembles the script tag of splitData from the fragments into w, like serialize,
+// and returns the number of bytes written and the first error of w
+func (fragments *fragments) write(w io.Writer, splitData SplitData, splitNames []string, serializeSegments bool) (int64, error) {
+	writer := &scriptWriter{w: w}
+	if len(splitNames) == 0 {
+		writer.writeString(loggingScriptParts[0])
+		writer.writeEntries(fragments.splitNames, func(name string) (string, bool) {
+			return fragments.splits[name].entry, true
+		})
+		writer.writeString(loggingScriptParts[1])
+		writer.writeString(strconv.FormatInt(splitData.Since, 10))
+		writer.writeString(loggingScriptParts[2])
+		writer.writeEntries(fragments.segmentNames, func(name string) (string, bool) {
+			return fragments.segments[name].entry, true
+		})
+		writer.writeString(loggingScriptParts[3])
+		writer.writeString(strconv.Itoa(splitData.UsingSegmentsCount))
+		writer.writeString(loggingScriptParts[4])
+		return writer.written, writer.err
+	}
+
+	splitsSubset := map[string]dtos.SplitDTO{}
+	writer.writeString(loggingScriptParts[0])
+	writer.writeEntries(splitNames, func(name string) (string, bool) {
+		fragment, found := fragments.splits[name]
+		if found {
+			splitsSubset[name] = fragment.split
+		}
+		return fragment.entry, found
+	})
+	writer.writeString(loggingScriptParts[1])
+	writer.writeString(strconv.FormatInt(splitData.Since, 10))
+
+	segmentNames := fragments.segmentNames
+	usingSegmentsCount := splitData.UsingSegmentsCount
+	// get segments and usingSegmentsCount for subset of splits from the segments already in splitData
+	if serializeSegments {
+		var segmentNamesSubset map[string]bool
+		segmentNamesSubset, usingSegmentsCount = api.GetSegmentNamesForSplits(splitsSubset)
+		segmentNames = make([]string, 0, len(segmentNamesSubset))
+		for name := range segmentNamesSubset {
+			segmentNames = append(segmentNames, name)
+		}
+		sort.Strings(segmentNames)
+	}
+	writer.writeString(loggingScriptParts[2])
+	writer.writeEntries(segmentNames, func(name string) (string, bool) {
+		fragment, found := fragments.segments[name]
+		return fragment.entry, found
+	})
+	writer.writeString(loggingScriptParts[3])
+	writer.writeString(strconv.Itoa(usingSegmentsCount))
+	writer.writeString(loggingScriptParts[4])
+	return writer.written, writer.err
+}
+
+// marshalEntry returns the JSON object entry mapping name to the string value, encoded like json.Marshal
+// encodes a map[string]string
+func marshalEntry(name string, value []byte) string {
+	marshalledName, _ := json.Marshal(name)
+	marshalledValue, _ := json.Marshal(string(value))
+	return string(marshalledName) + ":" + string(marshalledValue)
+}
+
+// scriptWriter writes strings to w until an error occurs, counting the bytes written
+type scriptWriter struct {
+	w       io.Writer
+	written int64
+	err     error
+}
+
+// writeString writes s unless a previous write failed
+func (writer *scriptWriter) writeString(s string) {
+	if writer.err != nil {
+		return
+	}
+	written, err := io.WriteString(writer.w, s)
+	writer.written += int64(written)
+	writer.err = err
+}
+
+// writeEntries writes the JSON object made of the entries found for the sorted names,
+// identical to the output of json.Marshal for a map[string]string
+func (writer *scriptWriter) writeEntries(names []string, getEntry func(name string) (string, bool)) {
+	writer.writeString("{")
+	first := true
+	for _, name := range names {
+		entry, found := getEntry(name)
+		if !found {
+			continue
+		}
+		if !first {
+			writer.writeString(",")
+		}
+		writer.writeString(entry)
+		first = false
+	}
+	writer.writeString("}")
+}
@@ -0,0 +1,208 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/splitio/go-split-commons/dtos"
+	"github.com/stretchr/testify/assert"
+)
+
+// marshalThroughMaps serializes the splits and segments of splitData with json.Marshal of map[string]string,
+// which fragments must produce identically
+func marshalThroughMaps(splitData SplitData) (string, string) {
+	splitsData := map[string]string{}
+	for _, split := range splitData.Splits {
+		marshalledSplit, _ := json.Marshal(split)
+		splitsData[split.Name] = string(marshalledSplit)
+	}
+	segmentsData := map[string]string{}
+	for _, segment := range splitData.Segments {
+		marshalledSegment, _ := json.Marshal(segment)
+		segmentsData[segment.Name] = string(marshalledSegment)
+	}
+	marshalledSplits, _ := json.Marshal(splitsData)
+	marshalledSegments, _ := json.Marshal(segmentsData)
+	return string(marshalledSplits), string(marshalledSegments)
+}
+
+func TestFragmentsSerializeLikeJSONMaps(t *testing.T) {
+	// Arrange
+	splitData := SplitData{
+		Splits: map[string]dtos.SplitDTO{
+			"checkout.v2":        {Name: "checkout.v2", ChangeNumber: 1, DefaultTreatment: "<on & off>"},
+			"checkout":           {Name: "checkout", ChangeNumber: 2, Status: `"quoted"`},
+			"été":                {Name: "été", ChangeNumber: 3},
+			"<script>&</script>": {Name: "<script>&</script>", ChangeNumber: 4},
+		},
+		Since: 4,
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"segment-b": {Name: "segment-b", Added: []string{"<b>"}, Till: 1},
+			"segment-a": {Name: "segment-a", Added: []string{"a&a"}, Till: 2},
+		},
+		UsingSegmentsCount: 1,
+	}
+	expectedSplitsData, expectedSegmentsData := marshalThroughMaps(splitData)
+
+	// Act
+	result := newFragments(splitData, nil).serialize(splitData, []string{}, true)
+
+	// Validate
+	assert.Equal(t, result, fmt.Sprintf(formattedLoggingScript, expectedSplitsData, 4, expectedSegmentsData, 1))
+}
+
+func TestFragmentsSerializeSubset(t *testing.T) {
+	// Arrange
+	splitUsingSegment := dtos.SplitDTO{
+		Name:         "mock-split-using-segment",
+		ChangeNumber: 2,
+		Conditions: []dtos.ConditionDTO{{
+			MatcherGroup: dtos.MatcherGroupDTO{
+				Matchers: []dtos.MatcherDTO{{
+					MatcherType:        "IN_SEGMENT",
+					UserDefinedSegment: &dtos.UserDefinedSegmentMatcherDataDTO{SegmentName: "mock-segment-1"},
+				}},
+			},
+		}},
+	}
+	splitData := SplitData{
+		Splits: map[string]dtos.SplitDTO{
+			"mock-split-1":             mockMultipleSplits["mock-split-1"],
+			"mock-split-2":             mockMultipleSplits["mock-split-2"],
+			"mock-split-using-segment": splitUsingSegment,
+		},
+		Since:              1,
+		Segments:           mockSegments,
+		UsingSegmentsCount: 1,
+	}
+	subsetData := SplitData{
+		Splits: map[string]dtos.SplitDTO{
+			"mock-split-1":             mockMultipleSplits["mock-split-1"],
+			"mock-split-using-segment": splitUsingSegment,
+		},
+		Segments: mockSegments,
+	}
+	expectedSplitsData, expectedSegmentsData := marshalThroughMaps(subsetData)
+
+	// Act
+	result := newFragments(splitData, nil).serialize(splitData, []string{"mock-split-1", "mock-split-using-segment", "unknown-split"}, true)
+
+	// Validate that only the splits of the subset and the segments they use are serialized
+	assert.Equal(t, result, fmt.Sprintf(formattedLoggingScript, expectedSplitsData, 1, expectedSegmentsData, 1))
+}
+
+func TestNewFragmentsReusesUnchangedFragments(t *testing.T) {
+	// Arrange
+	previousSplitData := SplitData{
+		Splits: map[string]dtos.SplitDTO{
+			"mock-split-1": {Name: "mock-split-1", ChangeNumber: 1, Status: "ACTIVE"},
+			"mock-split-2": {Name: "mock-split-2", ChangeNumber: 1, Status: "ACTIVE"},
+		},
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"mock-segment-1": {Name: "mock-segment-1", Added: []string{"foo"}, Till: 1},
+			"mock-segment-2": {Name: "mock-segment-2", Added: []string{"foo"}, Till: 1},
+		},
+	}
+	previous := newFragments(previousSplitData, nil)
+	splitData := SplitData{
+		Splits: map[string]dtos.SplitDTO{
+			"mock-split-1": {Name: "mock-split-1", ChangeNumber: 1, Status: "ARCHIVED"},
+			"mock-split-2": {Name: "mock-split-2", ChangeNumber: 2, Status: "ARCHIVED"},
+		},
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"mock-segment-1": {Name: "mock-segment-1", Added: []string{"bar"}, Till: 1},
+			"mock-segment-2": {Name: "mock-segment-2", Added: []string{"bar"}, Till: 2},
+		},
+	}
+
+	// Act
+	result := newFragments(splitData, previous)
+
+	// Validate that only the splits and segments whose changeNumber or till changed are marshalled again
+	assert.Equal(t, result.splits["mock-split-1"].entry, previous.splits["mock-split-1"].entry)
+	assert.NotEqual(t, result.splits["mock-split-2"].entry, previous.splits["mock-split-2"].entry)
+	assert.Contains(t, result.splits["mock-split-2"].entry, "ARCHIVED")
+	assert.Equal(t, result.splits["mock-split-1"].split, splitData.Splits["mock-split-1"])
+	assert.Equal(t, result.segments["mock-segment-1"].entry, previous.segments["mock-segment-1"].entry)
+	assert.Contains(t, result.segments["mock-segment-2"].entry, "bar")
+	assert.Equal(t, result.splitNames, []string{"mock-split-1", "mock-split-2"})
+	assert.Equal(t, result.segmentNames, []string{"mock-segment-1", "mock-segment-2"})
+}
+
+// benchmarkSplitData returns SplitData with splitCount splits, each using one of segmentCount segments
+func benchmarkSplitData(splitCount int, segmentCount int) SplitData {
+	splitData := SplitData{
+		Splits:   map[string]dtos.SplitDTO{},
+		Since:    1,
+		Segments: map[string]dtos.SegmentChangesDTO{},
+	}
+	for i := 0; i < segmentCount; i++ {
+		name := fmt.Sprintf("segment-%d", i)
+		splitData.Segments[name] = dtos.SegmentChangesDTO{Name: name, Added: []string{"foo", "bar", "baz"}, Till: 1}
+	}
+	for i := 0; i < splitCount; i++ {
+		name := fmt.Sprintf("split-%d", i)
+		splitData.Splits[name] = dtos.SplitDTO{
+			Name:         name,
+			ChangeNumber: 1,
+			Status:       "ACTIVE",
+			Conditions: []dtos.ConditionDTO{{
+				MatcherGroup: dtos.MatcherGroupDTO{
+					Matchers: []dtos.MatcherDTO{{
+						MatcherType:        "IN_SEGMENT",
+						UserDefinedSegment: &dtos.UserDefinedSegmentMatcherDataDTO{SegmentName: fmt.Sprintf("segment-%d", i%segmentCount)},
+					}},
+				},
+			}},
+		}
+	}
+	splitData.UsingSegmentsCount = splitCount
+	return splitData
+}
+
+// benchmarkSubsets returns subsetCount subsets of up to 5 sorted split names
+func benchmarkSubsets(subsetCount int, splitCount int) [][]string {
+	subsets := make([][]string, subsetCount)
+	for i := range subsets {
+		_, subsets[i] = subsetKey([]string{
+			fmt.Sprintf("split-%d", i%splitCount),
+			fmt.Sprintf("split-%d", (i*7+1)%splitCount),
+			fmt.Sprintf("split-%d", (i*13+2)%splitCount),
+			fmt.Sprintf("split-%d", (i*17+3)%splitCount),
+			fmt.Sprintf("split-%d", (i*19+4)%splitCount),
+		})
+	}
+	return subsets
+}
+
+// BenchmarkPollSerializationWithoutFragments serializes the full payload and every subset from scratch
+func BenchmarkPollSerializationWithoutFragments(b *testing.B) {
+	poller := NewPoller(testKey, 1, serializeSegments, &mockSplitio{})
+	splitData := benchmarkSplitData(400, 50)
+	subsets := benchmarkSubsets(200, 400)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serializeFragments(splitData, nil, poller.isSerializingSegments(), []string{})
+		for _, splitNames := range subsets {
+			serializeFragments(splitData, nil, poller.isSerializingSegments(), splitNames)
+		}
+	}
+}
+
+// BenchmarkPollSerializationWithFragments serializes the full payload and every subset from the fragments
+// of the previous poll, as polls do when no split changed
+func BenchmarkPollSerializationWithFragments(b *testing.B) {
+	poller := NewPoller(testKey, 1, serializeSegments, &mockSplitio{})
+	splitData := benchmarkSplitData(400, 50)
+	subsets := benchmarkSubsets(200, 400)
+	previous := newFragments(splitData, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		splitFragments := newFragments(splitData, previous)
+		serializeFragments(splitData, splitFragments, poller.isSerializingSegments(), []string{})
+		for _, splitNames := range subsets {
+			serializeFragments(splitData, splitFragments, poller.isSerializingSegments(), splitNames)
+		}
+	}
+}
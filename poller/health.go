@@ -0,0 +1,94 @@
+package poller
+
+import (
+	"strings"
+	"time"
+)
+
+// staleMarker is added to the serialized data served by the ServeWithMarker policy
+const staleMarker = `, stale: true`
+
+// StalenessPolicy is how serialized data is served when the last successful poll is older than the max staleness
+type StalenessPolicy int
+
+// The staleness policies: keep serving the cached data, serve an empty cache, or serve the cached data
+// with `stale: true` added to window.__splitCachePreload
+const (
+	ServeStale StalenessPolicy = iota
+	ServeEmpty
+	ServeWithMarker
+)
+
+// Health describes how up to date the cache of a Poller is
+type Health struct {
+	State               State
+	Ready               bool
+	LastSuccess         time.Time // zero if no poll succeeded
+	LastAttempt         time.Time // zero if no poll was made
+	ConsecutiveFailures int
+	LastError           error
+	Age                 time.Duration // time since the last successful poll, 0 if no poll succeeded
+	Stale               bool          // whether Age is greater than the max staleness
+}
+
+// SetStalenessPolicy sets how serialized data is served once the last successful poll is older than
+// maxStaleness. A maxStaleness of 0, the default, never considers the data stale.
+func (poller *Poller) SetStalenessPolicy(maxStaleness time.Duration, policy StalenessPolicy) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	poller.maxStaleness = maxStaleness
+	poller.stalenessPolicy = policy
+}
+
+// Health returns how up to date the cache is
+func (poller *Poller) Health() Health {
+	now := time.Now()
+	ready := poller.IsReady()
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	health := Health{
+		State:               poller.state,
+		Ready:               ready,
+		LastSuccess:         poller.lastSuccess,
+		LastAttempt:         poller.lastAttempt,
+		ConsecutiveFailures: poller.failures,
+		LastError:           poller.lastError,
+	}
+	if !poller.lastSuccess.IsZero() {
+		health.Age = now.Sub(poller.lastSuccess)
+	}
+	health.Stale = poller.isStale(now)
+	return health
+}
+
+// isStale returns whether the last successful poll is older than the max staleness. The mutex must be held.
+func (poller *Poller) isStale(now time.Time) bool {
+	return poller.maxStaleness > 0 && !poller.lastSuccess.IsZero() && now.Sub(poller.lastSuccess) > poller.maxStaleness
+}
+
+// isStalenessPolicyApplied returns whether the data is stale and served differently than the cached data
+func (poller *Poller) isStalenessPolicyApplied() bool {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return poller.stalenessPolicy != ServeStale && poller.isStale(time.Now())
+}
+
+// applyStalenessPolicy returns serializedData as it should be served according to the staleness policy
+func (poller *Poller) applyStalenessPolicy(serializedData string) string {
+	poller.mutex.Lock()
+	stale := poller.isStale(time.Now())
+	policy := poller.stalenessPolicy
+	poller.mutex.Unlock()
+	if !stale {
+		return serializedData
+	}
+	switch policy {
+	case ServeEmpty:
+		return emptyCacheLoggingScript
+	case ServeWithMarker:
+		if strings.HasSuffix(serializedData, loggingScriptEnd) {
+			return strings.TrimSuffix(serializedData, loggingScriptEnd) + staleMarker + loggingScriptEnd
+		}
+	}
+	return serializedData
+}
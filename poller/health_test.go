@@ -0,0 +1,89 @@
+package poller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthBeforeFirstPoll(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, false, &mockSplitio{})
+
+	// Act
+	result := poller.Health()
+
+	// Validate
+	assert.Equal(t, result, Health{State: StateNew})
+}
+
+func TestHealthTracksPolls(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockSplitio{getSplitValid: true}
+	poller := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+	poller.SetErrorHandler(func(err error) {})
+	poller.poll(context.Background())
+	mockSplitioDataGetter.setValid(false, false)
+
+	// Act
+	poller.poll(context.Background())
+	result := poller.Health()
+
+	// Validate that the failed poll is the last attempt and the successful poll the last success
+	assert.True(t, result.Ready)
+	assert.False(t, result.LastSuccess.IsZero())
+	assert.False(t, result.LastAttempt.Before(result.LastSuccess))
+	assert.Equal(t, result.ConsecutiveFailures, 1)
+	assert.EqualError(t, result.LastError, "Error from splitio API when getting splits")
+	assert.True(t, result.Age > 0)
+	assert.False(t, result.Stale)
+}
+
+func HelperTestStaleSerializedData(t *testing.T, policy StalenessPolicy) (*Poller, string) {
+	// Arrange
+	poller := NewPoller(testKey, 1, false, &mockSplitio{getSplitValid: true})
+	poller.SetStalenessPolicy(time.Hour, policy)
+	poller.poll(context.Background())
+	freshSerializedData := poller.GetSerializedData([]string{})
+	assert.Equal(t, freshSerializedData, poller.getSerializedData())
+	assert.False(t, poller.Health().Stale)
+
+	// Act
+	poller.mutex.Lock()
+	poller.lastSuccess = time.Now().Add(-2 * time.Hour)
+	poller.mutex.Unlock()
+
+	// Validate that the data is reported as stale
+	assert.True(t, poller.Health().Stale)
+	return poller, poller.GetSerializedData([]string{})
+}
+
+func TestServeStaleKeepsServingCachedData(t *testing.T) {
+	poller, result := HelperTestStaleSerializedData(t, ServeStale)
+	assert.Equal(t, result, poller.getSerializedData())
+}
+
+func TestServeEmptyServesEmptyCache(t *testing.T) {
+	poller, result := HelperTestStaleSerializedData(t, ServeEmpty)
+	assert.Equal(t, result, emptyCacheLoggingScript)
+	assert.Equal(t, poller.GetSerializedData([]string{"mock-split"}), emptyCacheLoggingScript)
+}
+
+func TestServeWithMarkerAddsStaleMarker(t *testing.T) {
+	poller, result := HelperTestStaleSerializedData(t, ServeWithMarker)
+	expected := strings.TrimSuffix(poller.getSerializedData(), " }</script>") + ", stale: true }</script>"
+	assert.Equal(t, result, expected)
+	assert.True(t, strings.HasSuffix(poller.GetSerializedData([]string{"mock-split"}), ", usingSegmentsCount: 0, stale: true }</script>"))
+}
+
+func TestWriteSerializedDataAppliesStalenessPolicy(t *testing.T) {
+	poller, result := HelperTestStaleSerializedData(t, ServeWithMarker)
+	var streamed strings.Builder
+	written, err := poller.WriteSerializedData(&streamed, []string{})
+	assert.Nil(t, err)
+	assert.Equal(t, written, int64(len(result)))
+	assert.Equal(t, streamed.String(), result)
+}
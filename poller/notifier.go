@@ -0,0 +1,53 @@
+package poller
+
+import "sync"
+
+// notifier calls the error handler of a Poller one at a time, in the order the errors were queued,
+// from a goroutine that is neither polling, stopping the Poller nor calling the change handlers,
+// so that the error handler can call Stop and is never delayed by a slow change handler.
+// At most maxQueued notifications wait, further notifications are dropped.
+// The goroutine is started when a notification is queued and returns once the queue is empty.
+type notifier struct {
+	mutex     sync.Mutex
+	queue     []func()
+	maxQueued int
+	running   bool
+}
+
+// newNotifier returns a notifier with an empty queue holding at most maxQueued notifications
+func newNotifier(maxQueued int) *notifier {
+	return &notifier{maxQueued: maxQueued}
+}
+
+// notify queues notification, starting the goroutine calling the notifications if it is not running.
+// It returns false when the queue is full and notification was dropped.
+func (notifier *notifier) notify(notification func()) bool {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if len(notifier.queue) >= notifier.maxQueued {
+		return false
+	}
+	notifier.queue = append(notifier.queue, notification)
+	if !notifier.running {
+		notifier.running = true
+		go notifier.run()
+	}
+	return true
+}
+
+// run calls the queued notifications until the queue is empty
+func (notifier *notifier) run() {
+	for {
+		notifier.mutex.Lock()
+		if len(notifier.queue) == 0 {
+			notifier.running = false
+			notifier.mutex.Unlock()
+			return
+		}
+		notification := notifier.queue[0]
+		notifier.queue[0] = nil
+		notifier.queue = notifier.queue[1:]
+		notifier.mutex.Unlock()
+		notification()
+	}
+}
@@ -0,0 +1,50 @@
+package poller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifierCallsNotificationsInOrder(t *testing.T) {
+	// Arrange
+	notifier := newNotifier(100)
+	calls := make(chan int, 100)
+
+	// Act
+	for i := 0; i < 100; i++ {
+		index := i
+		notifier.notify(func() { calls <- index })
+	}
+
+	// Validate that the notifications are called one at a time in the order they were queued
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, <-calls, i)
+	}
+}
+
+func TestNotifierDropsNotificationsWhenFull(t *testing.T) {
+	// Arrange
+	notifier := newNotifier(2)
+	started := make(chan bool)
+	release := make(chan bool)
+	calls := make(chan int, 3)
+	notifier.notify(func() {
+		started <- true
+		<-release
+	})
+	<-started
+
+	// Act
+	queued := []bool{
+		notifier.notify(func() { calls <- 1 }),
+		notifier.notify(func() { calls <- 2 }),
+		notifier.notify(func() { calls <- 3 }),
+	}
+	release <- true
+
+	// Validate that notifications above maxQueued are dropped while the queue is full
+	assert.Equal(t, queued, []bool{true, true, false})
+	assert.Equal(t, <-calls, 1)
+	assert.Equal(t, <-calls, 2)
+}
@@ -1,11 +1,13 @@
 package poller
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
-	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -16,7 +18,14 @@ import (
 
 const emptyCacheLoggingScript = `<script>window.__splitCachePreload = {}</script>`
 
-const formattedLoggingScript = `<script>window.__splitCachePreload = { splitsData: %v, since: %v, segmentsData: %v, usingSegmentsCount: %v }</script>`
+// errorChannelSize is the number of errors buffered by the Error channel, or queued for the error handler,
+// before errors are dropped
+const errorChannelSize = 16
+
+// loggingScriptEnd closes the window.__splitCachePreload object and the script of formattedLoggingScript
+const loggingScriptEnd = ` }</script>`
+
+const formattedLoggingScript = `<script>window.__splitCachePreload = { splitsData: %v, since: %v, segmentsData: %v, usingSegmentsCount: %v` + loggingScriptEnd
 
 // Fetcher is an interface contains GetSerializedData, Start and Stop functions
 type Fetcher interface {
@@ -25,21 +34,85 @@ type Fetcher interface {
 	GetSerializedData(splitNames []string) string
 }
 
+// StreamingFetcher is a Fetcher that can also write the serialized data to an io.Writer
+type StreamingFetcher interface {
+	Fetcher
+	WriteSerializedData(w io.Writer, splitNames []string) (int64, error)
+}
+
+// State is the lifecycle state of a Poller
+type State int
+
+// The lifecycle states of a Poller: a new Poller is running once started, until it is stopped
+const (
+	StateNew State = iota
+	StateRunning
+	StateStopping
+	StateStopped
+)
+
+// String returns the name of the state
+func (state State) String() string {
+	switch state {
+	case StateNew:
+		return "new"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("State(%d)", int(state))
+}
+
 // Poller implements Fetcher and contains cache pointer, splitio, and required info to interact with aplitio api
 type Poller struct {
-	Error              chan error
-	splitio            api.Splitio
-	pollingRateSeconds int
-	serializeSegments  bool
-	quit               chan bool
-	cache              unsafe.Pointer
+	Error             chan error
+	splitio           api.Splitio
+	pollingInterval   time.Duration
+	serializeSegments bool
+	state             State
+	quit              chan struct{}
+	done              chan struct{}
+	cache             unsafe.Pointer
+	subsets           *subsetCache
+	pollTimeout       time.Duration
+	mutex             sync.Mutex
+	pollDeferredUntil time.Time
+	runningPoll       *pollCall
+	interruptingPolls bool
+	subscribers       []subscriber
+	lastSubscriberID  uint64
+	lastAttempt       time.Time
+	lastSuccess       time.Time
+	maxStaleness      time.Duration
+	stalenessPolicy   StalenessPolicy
+	schedulePolicy    SchedulePolicy
+	reschedule        chan struct{}
+	pollNow           chan struct{}
+	errorHandler      func(error)
+	errorNotifier     *notifier
+	pendingChanges    *SplitData
+	notifiedSplitData SplitData
+	notifyingChanges  bool
+	lastError         error
+	failures          int
+	droppedErrors     uint64
+	ready             chan struct{}
+	readyOnce         sync.Once
 }
 
-// Cache contains raw split data as well as the data in serialized format
+// Cache contains raw split data as well as the data in serialized format, and the serialized splits and segments
+// it is assembled from. serializeSegments is whether segments were fetched with the split data, so that every
+// payload served from the Cache is serialized the same way, even after SetSerializeSegments.
+// A Cache is never modified once stored, version is incremented by each poll.
 type Cache struct {
-	splitData             SplitData
-	serializedData        string
-	serializedDataSubsets map[string]string // key will be a period-delimited string of sorted split names (AKA a subset)
+	version           uint64
+	splitData         SplitData
+	serializedData    string
+	fragments         *fragments
+	serializeSegments bool
 }
 
 // SplitData contains Splits and Segments which is supposed to be updated periodically
@@ -58,38 +131,343 @@ type SplitCachePreload struct {
 	SegmentsData       string
 }
 
-// NewPoller returns a new Poller
+// Option configures optional behaviors of a Poller
+type Option func(*options)
+
+// options contains the configuration of a Poller being created
+type options struct {
+	apiURL            string
+	bindingOptions    []api.Option
+	splitio           api.Splitio
+	pollingInterval   time.Duration
+	serializeSegments bool
+	errorHandler      func(error)
+	maxSubsets        int
+	subsetTTL         time.Duration
+	pollTimeout       time.Duration
+	maxStaleness      time.Duration
+	stalenessPolicy   StalenessPolicy
+	schedulePolicy    SchedulePolicy
+}
+
+// WithAPIURL sets the URL of the Split.io API, defaults to https://sdk.split.io/api
+func WithAPIURL(apiURL string) Option {
+	return func(options *options) {
+		options.apiURL = apiURL
+	}
+}
+
+// WithBindingOptions sets the options of the binding to the Split.io API, e.g. api.WithHTTPClient
+func WithBindingOptions(bindingOptions ...api.Option) Option {
+	return func(options *options) {
+		options.bindingOptions = append(options.bindingOptions, bindingOptions...)
+	}
+}
+
+// WithSplitio sets the binding to the Split.io API, WithAPIURL and WithBindingOptions are then ignored
+func WithSplitio(splitio api.Splitio) Option {
+	return func(options *options) {
+		options.splitio = splitio
+	}
+}
+
+// WithPollingInterval sets the interval at which to poll Split.io, defaults to 5 minutes
+func WithPollingInterval(interval time.Duration) Option {
+	return func(options *options) {
+		if interval > 0 {
+			options.pollingInterval = interval
+		}
+	}
+}
+
+// WithSerializeSegments sets whether segments are fetched and serialized, defaults to false
+func WithSerializeSegments(serializeSegments bool) Option {
+	return func(options *options) {
+		options.serializeSegments = serializeSegments
+	}
+}
+
+// WithErrorHandler sets a function called with each error from the Split.io API, see SetErrorHandler
+func WithErrorHandler(handler func(error)) Option {
+	return func(options *options) {
+		options.errorHandler = handler
+	}
+}
+
+// WithSubsetCacheLimits sets the maximum number of cached subsets and their TTL, see SetSubsetCacheLimits
+func WithSubsetCacheLimits(maxSubsets int, ttl time.Duration) Option {
+	return func(options *options) {
+		options.maxSubsets = maxSubsets
+		options.subsetTTL = ttl
+	}
+}
+
+// WithPollTimeout sets the deadline of each poll, defaults to the polling interval
+func WithPollTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.pollTimeout = timeout
+	}
+}
+
+// WithStalenessPolicy sets how serialized data is served once it is older than maxStaleness, see SetStalenessPolicy
+func WithStalenessPolicy(maxStaleness time.Duration, policy StalenessPolicy) Option {
+	return func(options *options) {
+		options.maxStaleness = maxStaleness
+		options.stalenessPolicy = policy
+	}
+}
+
+// WithSchedulePolicy sets how the delay between two polls is computed, see SetSchedulePolicy
+func WithSchedulePolicy(policy SchedulePolicy) Option {
+	return func(options *options) {
+		options.schedulePolicy = policy
+	}
+}
+
+// NewPoller returns a new Poller polling every pollingRateSeconds, defaults to 300
 func NewPoller(splitioAPIKey string, pollingRateSeconds int, serializeSegments bool, splitio api.Splitio) *Poller {
-	if pollingRateSeconds == 0 {
-		pollingRateSeconds = 300
+	return NewPollerWithOptions(splitioAPIKey,
+		WithPollingInterval(time.Duration(pollingRateSeconds)*time.Second),
+		WithSerializeSegments(serializeSegments),
+		WithSplitio(splitio),
+	)
+}
+
+// NewPollerWithOptions returns a new Poller configured by options
+func NewPollerWithOptions(splitioAPIKey string, opts ...Option) *Poller {
+	config := options{
+		pollingInterval: 300 * time.Second,
+		maxSubsets:      defaultMaxSubsets,
+		schedulePolicy:  DefaultSchedulePolicy(),
+	}
+	for _, option := range opts {
+		option(&config)
 	}
+	splitio := config.splitio
 	if splitio == nil {
-		splitio = api.NewSplitioAPIBinding(splitioAPIKey, "")
+		splitio = api.NewSplitioAPIBinding(splitioAPIKey, config.apiURL, config.bindingOptions...)
 	}
 	emptyCache := Cache{
-		splitData:             SplitData{},
-		serializedData:        emptyCacheLoggingScript,
-		serializedDataSubsets: make(map[string]string),
+		splitData:      SplitData{},
+		serializedData: emptyCacheLoggingScript,
+	}
+	subsets := newSubsetCache()
+	subsets.setLimits(config.maxSubsets, config.subsetTTL)
+	return &Poller{
+		Error:             make(chan error, errorChannelSize),
+		splitio:           splitio,
+		pollingInterval:   config.pollingInterval,
+		serializeSegments: config.serializeSegments,
+		cache:             unsafe.Pointer(&emptyCache),
+		subsets:           subsets,
+		pollTimeout:       config.pollTimeout,
+		errorHandler:      config.errorHandler,
+		errorNotifier:     newNotifier(errorChannelSize),
+		ready:             make(chan struct{}),
+		maxStaleness:      config.maxStaleness,
+		stalenessPolicy:   config.stalenessPolicy,
+		schedulePolicy:    config.schedulePolicy.clamped(),
+		reschedule:        make(chan struct{}, 1),
+		pollNow:           make(chan struct{}, 1),
 	}
-	return &Poller{make(chan error), splitio, pollingRateSeconds, serializeSegments, make(chan bool), unsafe.Pointer(&emptyCache)}
 }
 
-// pollForChanges updates the Cache with latest splits and segment
-func (poller *Poller) pollForChanges() {
-	binding := poller.splitio
-	splits, since, err := binding.GetSplits()
-	if err != nil {
-		poller.Error <- err
+// SetPollTimeout sets the deadline of each poll, defaults to the polling interval
+func (poller *Poller) SetPollTimeout(timeout time.Duration) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	poller.pollTimeout = timeout
+}
+
+// SetSubsetCacheLimits sets the maximum number of subsets of splits whose serialized data is cached,
+// defaults to 1000, and how long an unused subset stays cached, 0 keeps it until it is evicted.
+// When the cache is full, the least recently used subset is evicted.
+func (poller *Poller) SetSubsetCacheLimits(maxSubsets int, ttl time.Duration) {
+	poller.subsets.setLimits(maxSubsets, ttl)
+}
+
+// SubsetCacheStats returns the usage statistics of the cache of serialized data subsets
+func (poller *Poller) SubsetCacheStats() SubsetCacheStats {
+	return poller.subsets.stats()
+}
+
+// SetErrorHandler sets a function called with each error from the Split.io API instead of sending it
+// to the Error channel. It is called after the failed poll, one error at a time, from a goroutine that
+// neither polls nor calls the change handlers, so a slow handler never delays polling. Up to 16 errors
+// wait for the handler, further errors are dropped and counted by DroppedErrors. It may call Stop.
+func (poller *Poller) SetErrorHandler(handler func(error)) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	poller.errorHandler = handler
+}
+
+// LastError returns the error of the last failed poll, nil if no poll failed
+func (poller *Poller) LastError() error {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return poller.lastError
+}
+
+// ConsecutiveFailures returns the number of polls that failed since the last successful poll
+func (poller *Poller) ConsecutiveFailures() int {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return poller.failures
+}
+
+// DroppedErrors returns the number of errors dropped because the Error channel, or the queue of the error handler, was full
+func (poller *Poller) DroppedErrors() uint64 {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return poller.droppedErrors
+}
+
+// SetPollingInterval sets the interval at which to poll Split.io. A running Poller schedules
+// its next poll from now with the new interval. Intervals below or equal to 0 are ignored.
+func (poller *Poller) SetPollingInterval(interval time.Duration) {
+	if interval <= 0 {
 		return
 	}
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	poller.pollingInterval = interval
+	poller.signalJobs(poller.reschedule)
+}
+
+// SetSerializeSegments sets whether segments are fetched and serialized. When changed,
+// a running Poller polls immediately so that the cache includes, or stops including, segments.
+// Until the next poll, the serialized data is still generated the way the cached data was fetched.
+func (poller *Poller) SetSerializeSegments(serializeSegments bool) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if poller.serializeSegments == serializeSegments {
+		return
+	}
+	poller.serializeSegments = serializeSegments
+	poller.signalJobs(poller.pollNow)
+}
+
+// isSerializingSegments returns whether segments are fetched and serialized
+func (poller *Poller) isSerializingSegments() bool {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return poller.serializeSegments
+}
+
+// signalJobs sends a signal to the polling goroutine if the Poller is running,
+// without blocking when a signal is already pending. The mutex must be held.
+func (poller *Poller) signalJobs(signal chan struct{}) {
+	if poller.state != StateRunning {
+		return
+	}
+	select {
+	case signal <- struct{}{}:
+	default:
+	}
+}
+
+// getPollTimeout returns the deadline of each poll
+func (poller *Poller) getPollTimeout() time.Duration {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if poller.pollTimeout > 0 {
+		return poller.pollTimeout
+	}
+	return poller.pollingInterval
+}
+
+// Refresh polls Split.io immediately and returns the error of the poll, or ctx.Err() if ctx is done first.
+// If a poll is already in progress, Refresh waits for it instead of starting another one.
+// The poll is not interrupted when ctx is done, only Stop and the poll timeout interrupt it.
+// The polling schedule is not changed.
+func (poller *Poller) Refresh(ctx context.Context) error {
+	return poller.poll(ctx)
+}
+
+// pollCall is a poll in progress, whose result is shared by all the callers waiting for it
+type pollCall struct {
+	done   chan struct{}
+	err    error
+	cancel context.CancelFunc
+}
+
+// poll starts a poll, or joins the poll in progress, and returns its error, or ctx.Err() if ctx is done first.
+// The poll runs in its own goroutine under a context owned by the Poller, so it is not interrupted when
+// ctx is done, but only by the poll timeout or by stopping the Poller.
+func (poller *Poller) poll(ctx context.Context) error {
+	timeout := poller.getPollTimeout()
+	poller.mutex.Lock()
+	call := poller.runningPoll
+	if call == nil {
+		pollCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		call = &pollCall{done: make(chan struct{}), cancel: cancel}
+		poller.runningPoll = call
+		if poller.interruptingPolls {
+			cancel()
+		}
+		go poller.runPoll(pollCtx, call)
+	}
+	poller.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runPoll polls with ctx and shares the result with the callers waiting for call
+func (poller *Poller) runPoll(ctx context.Context, call *pollCall) {
+	defer call.cancel()
+	call.err = poller.pollForChangesContext(ctx)
+
+	poller.mutex.Lock()
+	poller.runningPoll = nil
+	poller.mutex.Unlock()
+	close(call.done)
+}
+
+// cancelRunningPoll interrupts the poll in progress, if any, and the polls started until the Poller is stopped.
+// It does nothing unless the Poller is stopping.
+func (poller *Poller) cancelRunningPoll() {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if poller.state != StateStopping {
+		return
+	}
+	poller.interruptingPolls = true
+	if poller.runningPoll != nil {
+		poller.runningPoll.cancel()
+	}
+}
+
+// pollForChangesContext updates the Cache with latest splits and segment, giving up when ctx is done,
+// and returns the error of the poll. Errors are not reported when ctx is cancelled, which only happens
+// when the poller is stopping, as opposed to ctx exceeding the poll timeout.
+func (poller *Poller) pollForChangesContext(ctx context.Context) error {
+	poller.mutex.Lock()
+	poller.lastAttempt = time.Now()
+	poller.mutex.Unlock()
+
+	splits, since, err := poller.getSplits(ctx, poller.getSplitData())
+	if err != nil {
+		if ctx.Err() != context.Canceled {
+			poller.reportError(err)
+		}
+		return err
+	}
 
 	segments := map[string]dtos.SegmentChangesDTO{}
 	usingSegmentsCount := 0
-	if poller.serializeSegments {
-		segments, usingSegmentsCount, err = binding.GetSegmentsForSplits(splits)
+	serializeSegments := poller.isSerializingSegments()
+	if serializeSegments {
+		segments, usingSegmentsCount, err = poller.getSegmentsForSplits(ctx, splits)
 		if err != nil {
-			poller.Error <- err
-			return
+			if ctx.Err() != context.Canceled {
+				poller.reportError(err)
+			}
+			return err
 		}
 	}
 
@@ -100,149 +478,355 @@ func (poller *Poller) pollForChanges() {
 		Segments:           segments,
 		UsingSegmentsCount: usingSegmentsCount,
 	}
-	serializedData := poller.generateSerializedData(splitData, []string{})
-
+	previousCache := poller.getCache()
+	splitFragments := newFragments(splitData, previousCache.fragments)
 	updatedCache := Cache{
-		splitData:             splitData,
-		serializedData:        serializedData,
-		serializedDataSubsets: poller.getUpdatedSerializedDataSubsets(splitData),
+		version:           previousCache.version + 1,
+		splitData:         splitData,
+		serializedData:    serializeFragments(splitData, splitFragments, serializeSegments, []string{}),
+		fragments:         splitFragments,
+		serializeSegments: serializeSegments,
 	}
+	poller.updateSerializedDataSubsets(&updatedCache)
 	atomic.StorePointer(&poller.cache, unsafe.Pointer(&updatedCache))
+	poller.notifySubscribers(previousCache.splitData, splitData)
+
+	poller.mutex.Lock()
+	poller.failures = 0
+	poller.lastSuccess = time.Now()
+	poller.mutex.Unlock()
+	poller.readyOnce.Do(func() { close(poller.ready) })
+	return nil
+}
+
+// reportError records err and queues it for the error handler, or sends it to the Error channel without blocking,
+// deferring the next poll when Split.io rate limited the request and asked to retry later
+func (poller *Poller) reportError(err error) {
+	poller.mutex.Lock()
+	var rateLimitErr *api.RateLimitError
+	if errors.As(err, &rateLimitErr) && rateLimitErr.RetryAfter > 0 {
+		poller.pollDeferredUntil = time.Now().Add(rateLimitErr.RetryAfter)
+	}
+	poller.lastError = err
+	poller.failures++
+	handler := poller.errorHandler
+	poller.mutex.Unlock()
+
+	queued := false
+	if handler != nil {
+		queued = poller.errorNotifier.notify(func() { handler(err) })
+	} else {
+		select {
+		case poller.Error <- err:
+			queued = true
+		default:
+		}
+	}
+	if !queued {
+		poller.mutex.Lock()
+		poller.droppedErrors++
+		poller.mutex.Unlock()
+	}
+}
+
+// isPollDeferred returns whether polls are deferred at the time now because of rate limiting
+func (poller *Poller) isPollDeferred(now time.Time) bool {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return now.Before(poller.pollDeferredUntil)
+}
+
+// getSplits returns the latest splits, resuming from the cached since when the binding
+// supports incremental synchronization and stopping when ctx is done if it supports contexts
+func (poller *Poller) getSplits(ctx context.Context, cachedSplitData SplitData) (map[string]dtos.SplitDTO, int64, error) {
+	isFirstSync := cachedSplitData.Splits == nil
+	switch binding := poller.splitio.(type) {
+	case api.SplitioContext:
+		if isFirstSync {
+			return binding.GetSplitsContext(ctx)
+		}
+		return binding.GetSplitChangesContext(ctx, cachedSplitData.Since, cachedSplitData.Splits)
+	case api.IncrementalSplitio:
+		if isFirstSync {
+			return binding.GetSplits()
+		}
+		return binding.GetSplitChanges(cachedSplitData.Since, cachedSplitData.Splits)
+	default:
+		return binding.GetSplits()
+	}
+}
+
+// getSegmentsForSplits returns the segments used by splits, stopping when ctx is done if the binding supports contexts
+func (poller *Poller) getSegmentsForSplits(ctx context.Context, splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error) {
+	if binding, isContext := poller.splitio.(api.SplitioContext); isContext {
+		return binding.GetSegmentsForSplitsContext(ctx, splits)
+	}
+	return poller.splitio.GetSegmentsForSplits(splits)
 }
 
 // GetSerializedData returns serialized data cache results
 func (poller *Poller) GetSerializedData(splitNames []string) string {
 	if len(splitNames) > 0 {
-		return poller.getSerializedDataSubset(splitNames)
+		return poller.applyStalenessPolicy(poller.getSerializedDataSubset(splitNames))
+	}
+	return poller.applyStalenessPolicy(poller.getSerializedData())
+}
+
+// WriteSerializedData writes the serialized data GetSerializedData returns to w, without copying the cached data.
+// A subset that is not cached yet is assembled directly into w, and copied once to be cached. It returns
+// the number of bytes written and the error of w, if any.
+func (poller *Poller) WriteSerializedData(w io.Writer, splitNames []string) (int64, error) {
+	if poller.isStalenessPolicyApplied() {
+		written, err := io.WriteString(w, poller.GetSerializedData(splitNames))
+		return int64(written), err
+	}
+	if len(splitNames) > 0 {
+		return poller.writeSerializedDataSubset(w, splitNames)
 	}
-	return poller.getSerializedData()
+	written, err := io.WriteString(w, poller.getSerializedData())
+	return int64(written), err
 }
 
 // Start creates a goroutine and keep tracking until it stops
 func (poller *Poller) Start() {
-	poller.pollForChanges()
-	go poller.jobs()
+	poller.StartContext(context.Background())
+}
+
+// StartContext makes the initial request for changes, waiting for it until ctx is done, and starts polling.
+// It returns the error of the initial request, or ctx.Err(), in which case polling still starts and the Poller
+// becomes ready after the first successful poll. It does nothing if the Poller is already running,
+// waits for the Poller to stop if it is stopping, and restarts polling if it was stopped.
+func (poller *Poller) StartContext(ctx context.Context) error {
+	poller.mutex.Lock()
+	for poller.state == StateStopping {
+		done := poller.done
+		poller.mutex.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		poller.mutex.Lock()
+	}
+	if poller.state == StateRunning {
+		poller.mutex.Unlock()
+		return nil
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	poller.state = StateRunning
+	poller.interruptingPolls = false
+	poller.quit = quit
+	poller.done = done
+	poller.mutex.Unlock()
+
+	err := poller.poll(ctx)
+	go poller.jobs(quit, done)
+	return err
+}
+
+// Ready returns a channel closed once a poll succeeded and the cache contains split data
+func (poller *Poller) Ready() <-chan struct{} {
+	return poller.ready
+}
+
+// IsReady returns whether a poll succeeded and the cache contains split data
+func (poller *Poller) IsReady() bool {
+	select {
+	case <-poller.ready:
+		return true
+	default:
+		return false
+	}
 }
 
-// Stop sets quit to true in order to stop the loop
+// WaitUntilReady blocks until a poll succeeded, returning ctx.Err() if ctx is done before
+func (poller *Poller) WaitUntilReady(ctx context.Context) error {
+	select {
+	case <-poller.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop interrupts the poll in progress, if any, including one started by Refresh, and waits for polling to stop.
+// It does nothing if the Poller is not running. It may be called from change and error handlers,
+// which do not run on the polling goroutine, but change and error handlers may still be called after it returns.
 func (poller *Poller) Stop() {
-	poller.quit <- true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	poller.StopContext(ctx)
+}
+
+// StopContext stops polling, waiting for the poll in progress, if any, to finish.
+// When ctx is done first, the poll in progress is interrupted and ctx.Err() is returned once polling stopped.
+// It does nothing if the Poller is not running.
+func (poller *Poller) StopContext(ctx context.Context) error {
+	poller.mutex.Lock()
+	switch poller.state {
+	case StateNew, StateStopped:
+		poller.mutex.Unlock()
+		return nil
+	case StateRunning:
+		poller.state = StateStopping
+		close(poller.quit)
+	}
+	done := poller.done
+	poller.mutex.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		poller.cancelRunningPoll()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// State returns the lifecycle state of the Poller
+func (poller *Poller) State() State {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	return poller.state
 }
 
-// jobs controls whether keep or stop running
-func (poller *Poller) jobs() {
-	ticker := time.NewTicker(time.Duration(poller.pollingRateSeconds) * time.Second)
+// jobs polls on the schedule until quit is closed, then marks the Poller as stopped and closes done.
+// The next poll is rescheduled from now when signaled on reschedule, and happens immediately when signaled on pollNow.
+func (poller *Poller) jobs(quit <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	timer := time.NewTimer(poller.nextPollDelay(time.Now(), false))
+	defer timer.Stop()
 	for {
 		select {
-		case <-poller.quit:
-			ticker.Stop()
+		case <-quit:
+			poller.mutex.Lock()
+			poller.state = StateStopped
+			poller.interruptingPolls = false
+			poller.mutex.Unlock()
 			return
-		case <-ticker.C:
-			poller.pollForChanges()
+		case <-poller.reschedule:
+			resetTimer(timer, poller.nextPollDelay(time.Now(), false))
+		case <-poller.pollNow:
+			stopTimer(timer)
+			poller.scheduledPoll(quit, timer)
+		case <-timer.C:
+			poller.scheduledPoll(quit, timer)
 		}
 	}
 }
 
+// scheduledPoll polls unless polls are deferred, and resets the stopped timer to the next poll.
+// Nothing is done once quit is closed since jobs is returning.
+func (poller *Poller) scheduledPoll(quit <-chan struct{}, timer *time.Timer) {
+	select {
+	case <-quit:
+		return
+	default:
+	}
+	recovered := false
+	if !poller.isPollDeferred(time.Now()) {
+		failing := poller.ConsecutiveFailures() > 0
+		recovered = poller.poll(context.Background()) == nil && failing
+	}
+	timer.Reset(poller.nextPollDelay(time.Now(), recovered))
+}
+
+// stopTimer stops timer and drains its channel, so that it can be reset
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// resetTimer makes timer fire after delay
+func resetTimer(timer *time.Timer, delay time.Duration) {
+	stopTimer(timer)
+	timer.Reset(delay)
+}
+
 // getSerializedDataSubset returns serialized data for the splitNames provided
 func (poller *Poller) getSerializedDataSubset(splitNames []string) string {
-	currentSplitData := poller.getSplitData()
-	updatedSubsets := poller.getCachedSerializedDataSubsets()
-	sort.Strings(splitNames)
-	key := strings.Join(splitNames, ".")
+	currentCache := poller.getCache()
+	key, uniqueSplitNames := subsetKey(splitNames)
 
-	subset, inMap := updatedSubsets[key]
-	if inMap {
+	subset, inCache := poller.subsets.get(key, currentCache)
+	if inCache {
 		return subset
 	}
-	subset = poller.generateSerializedData(currentSplitData, splitNames)
-	updatedSubsets[key] = subset
+	subset = serializeFragments(currentCache.splitData, currentCache.fragments, currentCache.serializeSegments, uniqueSplitNames)
+	poller.subsets.set(key, uniqueSplitNames, currentCache, subset)
 
-	// update cache
-	updatedCache := Cache{
-		splitData:             currentSplitData,
-		serializedData:        poller.getSerializedData(),
-		serializedDataSubsets: updatedSubsets,
+	return subset
+}
+
+// writeSerializedDataSubset writes serialized data for the splitNames provided to w, caching it if it was not
+func (poller *Poller) writeSerializedDataSubset(w io.Writer, splitNames []string) (int64, error) {
+	currentCache := poller.getCache()
+	key, uniqueSplitNames := subsetKey(splitNames)
+
+	if subset, inCache := poller.subsets.get(key, currentCache); inCache {
+		written, err := io.WriteString(w, subset)
+		return int64(written), err
+	}
+	var subset strings.Builder
+	written, err := writeFragments(io.MultiWriter(w, &subset), currentCache.splitData, currentCache.fragments,
+		currentCache.serializeSegments, uniqueSplitNames)
+	if err == nil {
+		poller.subsets.set(key, uniqueSplitNames, currentCache, subset.String())
 	}
-	atomic.StorePointer(&poller.cache, unsafe.Pointer(&updatedCache))
 
-	return subset
+	return written, err
 }
 
-// getUpdatedSerializedDataSubsets updates cached serializedDataSubsets based on new split data
-func (poller *Poller) getUpdatedSerializedDataSubsets(newSplitData SplitData) map[string]string {
-	updatedSubsets := poller.getCachedSerializedDataSubsets()
-	for key := range updatedSubsets {
-		updatedSubsets[key] = poller.generateSerializedData(newSplitData, strings.Split(key, "."))
+// updateSerializedDataSubsets regenerates the cached subsets from a new Cache
+func (poller *Poller) updateSerializedDataSubsets(newCache *Cache) {
+	for key, splitNames := range poller.subsets.splitNames() {
+		subset := serializeFragments(newCache.splitData, newCache.fragments, newCache.serializeSegments, splitNames)
+		poller.subsets.refresh(key, newCache, subset)
 	}
-	return updatedSubsets
 }
 
-// generateSerializedData takes SplitData and generates a script tag
-// that saves the SplitData info to the window object of the browser
-func (poller *Poller) generateSerializedData(splitData SplitData, splitNames []string) string {
+// serializeFragments generates the script tag of splitData from its fragments, for the sorted splitNames if not empty,
+// including segments when serializeSegments. The fragments are generated when nil.
+func serializeFragments(splitData SplitData, splitFragments *fragments, serializeSegments bool, splitNames []string) string {
 	if reflect.DeepEqual(splitData, SplitData{}) {
 		return emptyCacheLoggingScript
 	}
-	splitNamesToSerializedData := map[string]string{}
-	splitsSubset := map[string]dtos.SplitDTO{}
-	serializingASubsetOfSplits := len(splitNames) > 0
-
-	// Serialize values for splits
-	for name, split := range splitData.Splits {
-		if serializingASubsetOfSplits {
-			index := sort.SearchStrings(splitNames, split.Name)
-			splitIsInSplitNames := index < len(splitNames) && splitNames[index] == split.Name
-			// if the split is not in the splitNames array, do not serialize the split
-			if !splitIsInSplitNames {
-				continue
-			}
-			splitsSubset[name] = split
-		}
-		marshalledSplit, _ := json.Marshal(split)
-		splitNamesToSerializedData[split.Name] = string(marshalledSplit)
+	if splitFragments == nil {
+		splitFragments = newFragments(splitData, nil)
 	}
+	return splitFragments.serialize(splitData, splitNames, serializeSegments)
+}
 
-	marshalledSplits, _ := json.Marshal(splitNamesToSerializedData)
-
-	segments := splitData.Segments
-	usingSegmentsCount := splitData.UsingSegmentsCount
-
-	// get segments and usingSegmentsCount for subset of splits
-	if poller.serializeSegments && serializingASubsetOfSplits {
-		var err error
-		binding := poller.splitio
-		segments, usingSegmentsCount, err = binding.GetSegmentsForSplits(splitsSubset)
-		if err != nil {
-			return emptyCacheLoggingScript
-		}
+// writeFragments writes the script tag serializeFragments generates to w
+func writeFragments(w io.Writer, splitData SplitData, splitFragments *fragments, serializeSegments bool, splitNames []string) (int64, error) {
+	if reflect.DeepEqual(splitData, SplitData{}) {
+		written, err := io.WriteString(w, emptyCacheLoggingScript)
+		return int64(written), err
 	}
-
-	segmentsData := map[string]string{}
-
-	// Serialize values for segments
-	for _, segment := range segments {
-		marshalledSegment, _ := json.Marshal(segment)
-		segmentsData[segment.Name] = string(marshalledSegment)
+	if splitFragments == nil {
+		splitFragments = newFragments(splitData, nil)
 	}
+	return splitFragments.write(w, splitData, splitNames, serializeSegments)
+}
 
-	marshalledSegments, _ := json.Marshal(segmentsData)
-
-	splitCachePreload := &SplitCachePreload{splitData.Since, usingSegmentsCount, string(marshalledSplits), string(marshalledSegments)}
-
-	return fmt.Sprintf(formattedLoggingScript, splitCachePreload.SplitsData, splitCachePreload.Since, splitCachePreload.SegmentsData, splitCachePreload.UsingSegmentsCount)
+// getCache returns the current cache
+func (poller *Poller) getCache() *Cache {
+	return (*Cache)(atomic.LoadPointer(&poller.cache))
 }
 
 // getSplitData returns cached split data
 func (poller *Poller) getSplitData() SplitData {
-	return (*(*Cache)(atomic.LoadPointer(&poller.cache))).splitData
+	return poller.getCache().splitData
 }
 
 // getSerializedData returns cached serialized data
 func (poller *Poller) getSerializedData() string {
-	return (*(*Cache)(atomic.LoadPointer(&poller.cache))).serializedData
-}
-
-// getCachedSerializedDataSubsets returns cached serialized data for split subsets
-func (poller *Poller) getCachedSerializedDataSubsets() map[string]string {
-	return (*(*Cache)(atomic.LoadPointer(&poller.cache))).serializedDataSubsets
+	return poller.getCache().serializedData
 }
@@ -1,7 +1,15 @@
 package poller
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -13,10 +21,9 @@ import (
 )
 
 const (
-	testKey                   = "someKey"
-	serializeSegments         = true
-	stringSegments            = `{"mock-segment-1":"{\"name\":\"mock-segment-1\",\"added\":[\"foo\",\"bar\"],\"removed\":null,\"since\":20,\"till\":20}"}`
-	stringSegmentsMockSplitIo = `{"mock-segment":"{\"name\":\"mock-segment\",\"added\":null,\"removed\":null,\"since\":0,\"till\":0}"}`
+	testKey           = "someKey"
+	serializeSegments = true
+	stringSegments    = `{"mock-segment-1":"{\"name\":\"mock-segment-1\",\"added\":[\"foo\",\"bar\"],\"removed\":null,\"since\":20,\"till\":20}"}`
 )
 
 var mockMultipleSplits = map[string]dtos.SplitDTO{
@@ -44,6 +51,7 @@ var mockSegments = map[string]dtos.SegmentChangesDTO{
 }
 
 type mockSplitio struct {
+	mutex                  sync.Mutex
 	mockSince              int64
 	mockUsingSegmentsCount int
 	getSplitValid          bool
@@ -51,7 +59,17 @@ type mockSplitio struct {
 	deterministic          bool
 }
 
+// setValid sets whether getting splits and segments succeeds, while the Poller may be polling
+func (splitio *mockSplitio) setValid(getSplitValid, getSegmentValid bool) {
+	splitio.mutex.Lock()
+	defer splitio.mutex.Unlock()
+	splitio.getSplitValid = getSplitValid
+	splitio.getSegmentValid = getSegmentValid
+}
+
 func (splitio *mockSplitio) GetSplits() (map[string]dtos.SplitDTO, int64, error) {
+	splitio.mutex.Lock()
+	defer splitio.mutex.Unlock()
 	if splitio.getSplitValid {
 		mockSplit := dtos.SplitDTO{Name: "mock-split"}
 		mockSplitMap := map[string]dtos.SplitDTO{
@@ -68,6 +86,8 @@ func (splitio *mockSplitio) GetSplits() (map[string]dtos.SplitDTO, int64, error)
 }
 
 func (splitio *mockSplitio) GetSegmentsForSplits(splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error) {
+	splitio.mutex.Lock()
+	defer splitio.mutex.Unlock()
 	if splitio.getSegmentValid {
 		mockSegment := dtos.SegmentChangesDTO{
 			Name: "mock-segment",
@@ -83,6 +103,80 @@ func (splitio *mockSplitio) GetSegmentsForSplits(splits map[string]dtos.SplitDTO
 	return nil, 0, fmt.Errorf("Error from splitio API when getting segments")
 }
 
+type mockIncrementalSplitio struct {
+	mockSplitio
+	requestedSince  []int64
+	requestedSplits []map[string]dtos.SplitDTO
+}
+
+func (splitio *mockIncrementalSplitio) GetSplitChanges(since int64, splits map[string]dtos.SplitDTO) (map[string]dtos.SplitDTO, int64, error) {
+	splitio.requestedSince = append(splitio.requestedSince, since)
+	splitio.requestedSplits = append(splitio.requestedSplits, splits)
+	mergedSplits := map[string]dtos.SplitDTO{}
+	for name, split := range splits {
+		mergedSplits[name] = split
+	}
+	mergedSplits[fmt.Sprintf("mock-split-since-%v", since)] = dtos.SplitDTO{Name: fmt.Sprintf("mock-split-since-%v", since)}
+	return mergedSplits, since + 10, nil
+}
+
+type mockContextSplitio struct {
+	mockIncrementalSplitio
+}
+
+func (splitio *mockContextSplitio) GetSplitsContext(ctx context.Context) (map[string]dtos.SplitDTO, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return splitio.GetSplits()
+}
+
+func (splitio *mockContextSplitio) GetSplitChangesContext(ctx context.Context, since int64, splits map[string]dtos.SplitDTO) (map[string]dtos.SplitDTO, int64, error) {
+	return splitio.GetSplitsContext(ctx)
+}
+
+func (splitio *mockContextSplitio) GetSegmentsForSplitsContext(ctx context.Context, splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return splitio.GetSegmentsForSplits(splits)
+}
+
+type mockRateLimitedSplitio struct {
+	mockSplitio
+	retryAfter time.Duration
+	calls      int32
+}
+
+func (splitio *mockRateLimitedSplitio) GetSplits() (map[string]dtos.SplitDTO, int64, error) {
+	atomic.AddInt32(&splitio.calls, 1)
+	return nil, 0, fmt.Errorf("wrapped: %w", &api.RateLimitError{StatusCode: 429, Status: "429 Too Many Requests", RetryAfter: splitio.retryAfter})
+}
+
+type mockBlockingSplitio struct {
+	mockIncrementalSplitio
+	started chan bool
+	release chan bool
+}
+
+func (splitio *mockBlockingSplitio) GetSplitsContext(ctx context.Context) (map[string]dtos.SplitDTO, int64, error) {
+	splitio.started <- true
+	select {
+	case <-splitio.release:
+		return map[string]dtos.SplitDTO{"mock-split": {Name: "mock-split"}}, 1, nil
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+func (splitio *mockBlockingSplitio) GetSplitChangesContext(ctx context.Context, since int64, splits map[string]dtos.SplitDTO) (map[string]dtos.SplitDTO, int64, error) {
+	return splitio.GetSplitsContext(ctx)
+}
+
+func (splitio *mockBlockingSplitio) GetSegmentsForSplitsContext(ctx context.Context, splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error) {
+	return nil, 0, ctx.Err()
+}
+
 func TestNewPollerValid(t *testing.T) {
 	// Arrange
 	pollingRateSeconds := 400
@@ -91,7 +185,7 @@ func TestNewPollerValid(t *testing.T) {
 	result := NewPoller(testKey, pollingRateSeconds, serializeSegments, nil)
 
 	// Validate that returned Poller has the correct type and values
-	assert.Equal(t, result.pollingRateSeconds, pollingRateSeconds)
+	assert.Equal(t, result.pollingInterval, 400*time.Second)
 	assert.Equal(t, result.serializeSegments, serializeSegments)
 	assert.IsType(t, result.splitio, &api.SplitioAPIBinding{})
 }
@@ -102,10 +196,68 @@ func TestNewSerializerDefaultPollingRateSeconds(t *testing.T) {
 
 	// Act
 	result := NewPoller(testKey, pollingRateSeconds, serializeSegments, nil)
-	expectedPollingRateSeconds := 300
+	expectedPollingInterval := 300 * time.Second
 
 	// Validate that returned Poller has the correct type and values
-	assert.Equal(t, result.pollingRateSeconds, expectedPollingRateSeconds)
+	assert.Equal(t, result.pollingInterval, expectedPollingInterval)
+}
+
+func TestNewPollerWithOptionsValid(t *testing.T) {
+	// Arrange
+	splitio := &mockSplitio{}
+	handledErrors := make(chan error, 1)
+
+	// Act
+	result := NewPollerWithOptions(testKey,
+		WithSplitio(splitio),
+		WithPollingInterval(90*time.Second),
+		WithSerializeSegments(true),
+		WithErrorHandler(func(err error) { handledErrors <- err }),
+		WithSubsetCacheLimits(2, time.Minute),
+		WithPollTimeout(30*time.Second),
+	)
+	result.reportError(errors.New("mock error"))
+
+	// Validate that returned Poller has the correct values
+	assert.Equal(t, result.splitio, splitio)
+	assert.Equal(t, result.pollingInterval, 90*time.Second)
+	assert.True(t, result.serializeSegments)
+	assert.EqualError(t, <-handledErrors, "mock error")
+	assert.Equal(t, result.subsets.maxEntries, 2)
+	assert.Equal(t, result.subsets.ttl, time.Minute)
+	assert.Equal(t, result.getPollTimeout(), 30*time.Second)
+}
+
+func TestNewPollerWithOptionsDefaults(t *testing.T) {
+	// Act
+	result := NewPollerWithOptions(testKey, WithPollingInterval(0))
+
+	// Validate that returned Poller has the default values
+	assert.IsType(t, result.splitio, &api.SplitioAPIBinding{})
+	assert.Equal(t, result.pollingInterval, 300*time.Second)
+	assert.False(t, result.serializeSegments)
+	assert.Equal(t, result.subsets.maxEntries, defaultMaxSubsets)
+	assert.Equal(t, result.getPollTimeout(), 300*time.Second)
+}
+
+func TestNewPollerWithOptionsCreatesBinding(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("Authorization"), "Bearer "+testKey)
+		fmt.Fprint(w, `{"splits":[{"name":"mock-split"}],"since":1,"till":1}`)
+	}))
+	defer server.Close()
+	result := NewPollerWithOptions(testKey,
+		WithAPIURL(server.URL),
+		WithBindingOptions(api.WithHTTPClient(server.Client())),
+	)
+
+	// Act
+	result.poll(context.Background())
+
+	// Validate that the binding requests the API URL with the binding options
+	assert.Equal(t, result.getSplitData().Splits["mock-split"].Name, "mock-split")
+	assert.Nil(t, result.LastError())
 }
 
 func TestPollforChangesValid(t *testing.T) {
@@ -115,7 +267,7 @@ func TestPollforChangesValid(t *testing.T) {
 	//Act
 	result := NewPoller(testKey, pollingRateSeconds, serializeSegments,
 		&mockSplitio{getSplitValid: true, getSegmentValid: true})
-	result.pollForChanges()
+	result.poll(context.Background())
 	returnedCache := result.getSplitData()
 
 	// Validate that after calling PollforChanges it returns the right value
@@ -123,6 +275,72 @@ func TestPollforChangesValid(t *testing.T) {
 	assert.Equal(t, 1, returnedCache.UsingSegmentsCount)
 }
 
+func TestPollforChangesResumesFromCachedSince(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockIncrementalSplitio{mockSplitio: mockSplitio{getSplitValid: true}}
+	result := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+
+	// Act
+	result.poll(context.Background())
+	firstSplitData := result.getSplitData()
+	result.poll(context.Background())
+	secondSplitData := result.getSplitData()
+
+	// Validate that the first poll falls back to a full GetSplits and the second one resumes from the cached since
+	assert.Equal(t, []int64{1}, mockSplitioDataGetter.requestedSince)
+	assert.Equal(t, firstSplitData.Splits, mockSplitioDataGetter.requestedSplits[0])
+	assert.Equal(t, int64(11), secondSplitData.Since)
+	assert.Equal(t, 4, len(secondSplitData.Splits))
+	assert.Equal(t, "mock-split-since-1", secondSplitData.Splits["mock-split-since-1"].Name)
+}
+
+func TestPollforChangesReturnsErrorAfterPollTimeout(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 1)}
+	result := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+	result.SetPollTimeout(50 * time.Millisecond)
+
+	// Act
+	go result.poll(context.Background())
+	err := <-result.Error
+
+	// Validate that the poll is given up once its deadline is exceeded
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, result.getSplitData(), SplitData{})
+}
+
+func TestGetPollTimeoutDefaultsToPollingRate(t *testing.T) {
+	// Act
+	result := NewPoller(testKey, 7, false, &mockSplitio{})
+
+	// Validate that the poll timeout defaults to the polling rate
+	assert.Equal(t, result.getPollTimeout(), 7*time.Second)
+}
+
+func TestStopInterruptsPollInProgress(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 1)}
+	result := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+	go result.Start()
+	<-mockSplitioDataGetter.started
+
+	// Act
+	stopped := make(chan bool)
+	go func() {
+		result.Stop()
+		stopped <- true
+	}()
+
+	// Validate that Stop returns without waiting for the poll timeout and no error is reported
+	select {
+	case <-stopped:
+	case err := <-result.Error:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Stop did not interrupt the poll in progress")
+	}
+}
+
 func TestStartValid(t *testing.T) {
 	// Arrange
 	pollingRateSeconds := 1
@@ -141,7 +359,62 @@ func TestStartValid(t *testing.T) {
 	cacheAfterStart := result.getSplitData()
 	assert.True(t, cacheAfterStart.Since > 1)
 	assert.True(t, cacheAfterStart.UsingSegmentsCount > 0)
-	result.quit <- true
+	result.Stop()
+}
+
+func TestStartContextReturnsInitialPollError(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, serializeSegments, &mockSplitio{getSplitValid: false})
+
+	// Act
+	err := result.StartContext(context.Background())
+	defer result.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Validate that the poller is not ready while the cache is empty
+	assert.EqualError(t, err, "Error from splitio API when getting splits")
+	assert.False(t, result.IsReady())
+	assert.Equal(t, result.WaitUntilReady(ctx), context.DeadlineExceeded)
+	assert.Equal(t, result.GetSerializedData([]string{}), emptyCacheLoggingScript)
+}
+
+func TestStartContextBecomesReady(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, serializeSegments,
+		&mockSplitio{getSplitValid: true, getSegmentValid: true})
+
+	// Act
+	err := result.StartContext(context.Background())
+	defer result.Stop()
+
+	// Validate
+	assert.Nil(t, err)
+	assert.True(t, result.IsReady())
+	assert.Nil(t, result.WaitUntilReady(context.Background()))
+	select {
+	case <-result.Ready():
+	default:
+		t.Error("Ready channel is not closed")
+	}
+}
+
+func TestWaitUntilReadyReturnsAfterRecovering(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockSplitio{getSplitValid: false}
+	result := NewPoller(testKey, 1, serializeSegments, mockSplitioDataGetter)
+	result.SetErrorHandler(func(err error) {})
+	result.poll(context.Background())
+	ready := make(chan error)
+	go func() { ready <- result.WaitUntilReady(context.Background()) }()
+
+	// Act
+	mockSplitioDataGetter.setValid(true, true)
+	result.poll(context.Background())
+
+	// Validate
+	assert.Nil(t, <-ready)
+	assert.True(t, result.IsReady())
 }
 
 func TestStopValid(t *testing.T) {
@@ -155,7 +428,7 @@ func TestStopValid(t *testing.T) {
 	// Validate that when Stop is called, jobs will stop
 	cacheBeforeStart := result.getSplitData()
 	assert.Equal(t, cacheBeforeStart.Since, int64(0))
-	go result.jobs()
+	result.Start()
 	time.Sleep(2 * time.Second)
 	result.Stop()
 	cacheAfterStop := result.getSplitData()
@@ -164,6 +437,274 @@ func TestStopValid(t *testing.T) {
 	assert.Equal(t, cacheAfterStop.Since, result.getSplitData().Since)
 }
 
+func TestStateFollowsLifecycle(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, false, &mockSplitio{getSplitValid: true})
+	stateBeforeStart := result.State()
+
+	// Act
+	result.Start()
+	stateAfterStart := result.State()
+	result.Stop()
+
+	// Validate
+	assert.Equal(t, stateBeforeStart, StateNew)
+	assert.Equal(t, stateAfterStart, StateRunning)
+	assert.Equal(t, result.State(), StateStopped)
+	assert.Equal(t, result.State().String(), "stopped")
+}
+
+func TestStopIsIdempotent(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, false, &mockSplitio{getSplitValid: true})
+
+	// Act
+	stopped := make(chan bool)
+	go func() {
+		result.Stop()
+		result.Start()
+		result.Stop()
+		result.Stop()
+		stopped <- true
+	}()
+
+	// Validate that Stop does not block before Start or when called twice
+	select {
+	case <-stopped:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Stop blocked")
+	}
+	assert.Equal(t, result.State(), StateStopped)
+}
+
+func TestStartTwiceStartsPollingOnce(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockRateLimitedSplitio{}
+	result := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+	result.SetErrorHandler(func(err error) {})
+
+	// Act
+	result.Start()
+	result.Start()
+	time.Sleep(1500 * time.Millisecond)
+	result.Stop()
+
+	// Validate that only the first Start polled and a single goroutine is polling
+	assert.Equal(t, int32(2), atomic.LoadInt32(&mockSplitioDataGetter.calls))
+}
+
+func TestStopContextWaitsForPollInProgress(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 1), release: make(chan bool)}
+	result := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+	go result.Start()
+	<-mockSplitioDataGetter.started
+
+	// Act
+	stopped := make(chan error)
+	go func() { stopped <- result.StopContext(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+	stateWhileStopping := result.State()
+	mockSplitioDataGetter.release <- true
+
+	// Validate that the poll in progress finished and updated the cache
+	assert.Nil(t, <-stopped)
+	assert.Equal(t, stateWhileStopping, StateStopping)
+	assert.Equal(t, result.State(), StateStopped)
+	assert.Equal(t, result.getSplitData().Splits["mock-split"].Name, "mock-split")
+}
+
+func TestStopContextInterruptsPollWhenContextIsDone(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 1)}
+	result := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+	go result.Start()
+	<-mockSplitioDataGetter.started
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err := result.StopContext(ctx)
+
+	// Validate
+	assert.Equal(t, err, context.DeadlineExceeded)
+	assert.Equal(t, result.State(), StateStopped)
+	assert.Len(t, result.Error, 0)
+}
+
+func TestStartAfterStopRestartsPolling(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, false, &mockSplitio{getSplitValid: true})
+	result.Start()
+	result.Stop()
+	sinceAfterStop := result.getSplitData().Since
+
+	// Act
+	result.Start()
+	defer result.Stop()
+	time.Sleep(1500 * time.Millisecond)
+
+	// Validate
+	assert.Equal(t, result.State(), StateRunning)
+	assert.True(t, result.getSplitData().Since > sinceAfterStop+1)
+}
+
+func TestRefreshUpdatesCache(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 300, serializeSegments,
+		&mockSplitio{mockSince: 10, getSplitValid: true, getSegmentValid: true})
+
+	// Act
+	err := result.Refresh(context.Background())
+
+	// Validate that the cache is updated without starting the poller
+	assert.Nil(t, err)
+	assert.Equal(t, result.getSplitData().Since, int64(11))
+	assert.Equal(t, result.State(), StateNew)
+}
+
+func TestRefreshReturnsPollError(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 300, serializeSegments, &mockSplitio{getSplitValid: false})
+	result.SetErrorHandler(func(err error) {})
+
+	// Act
+	err := result.Refresh(context.Background())
+
+	// Validate
+	assert.EqualError(t, err, "Error from splitio API when getting splits")
+}
+
+func TestConcurrentRefreshesShareOnePoll(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 10), release: make(chan bool)}
+	result := NewPoller(testKey, 300, false, mockSplitioDataGetter)
+	results := make(chan error, 3)
+	go func() { results <- result.Refresh(context.Background()) }()
+	<-mockSplitioDataGetter.started
+
+	// Act
+	for i := 0; i < 2; i++ {
+		go func() { results <- result.Refresh(context.Background()) }()
+	}
+	time.Sleep(100 * time.Millisecond)
+	mockSplitioDataGetter.release <- true
+
+	// Validate that a single request was made and all the callers got its result
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, <-results)
+	}
+	assert.Len(t, mockSplitioDataGetter.started, 0)
+	assert.Equal(t, result.getSplitData().Splits["mock-split"].Name, "mock-split")
+}
+
+func TestRefreshReturnsWhenContextIsDone(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 1), release: make(chan bool)}
+	result := NewPoller(testKey, 300, false, mockSplitioDataGetter)
+	go result.Refresh(context.Background())
+	<-mockSplitioDataGetter.started
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err := result.Refresh(ctx)
+	mockSplitioDataGetter.release <- true
+
+	// Validate that Refresh stopped waiting for the poll in progress
+	assert.Equal(t, err, context.DeadlineExceeded)
+}
+
+func TestRefreshesWithDifferentContextsShareOnePoll(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 10), release: make(chan bool)}
+	result := NewPoller(testKey, 300, false, mockSplitioDataGetter)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	firstResult := make(chan error, 1)
+	go func() { firstResult <- result.Refresh(ctx) }()
+	<-mockSplitioDataGetter.started
+
+	// Act
+	secondResult := make(chan error, 1)
+	go func() { secondResult <- result.Refresh(context.Background()) }()
+	firstErr := <-firstResult
+	mockSplitioDataGetter.release <- true
+
+	// Validate that the first caller giving up does not interrupt the poll the second caller waits for
+	assert.Equal(t, firstErr, context.DeadlineExceeded)
+	assert.Nil(t, <-secondResult)
+	assert.Len(t, mockSplitioDataGetter.started, 0)
+	assert.Equal(t, result.getSplitData().Splits["mock-split"].Name, "mock-split")
+}
+
+func TestRefreshReportsErrorAfterCallerGaveUp(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 1)}
+	result := NewPoller(testKey, 300, false, mockSplitioDataGetter)
+	result.SetPollTimeout(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Act
+	refreshErr := result.Refresh(ctx)
+	pollErr := <-result.Error
+
+	// Validate that the poll keeps running until the poll timeout and its failure is reported
+	assert.Equal(t, refreshErr, context.DeadlineExceeded)
+	assert.True(t, errors.Is(pollErr, context.DeadlineExceeded))
+	assert.Equal(t, result.ConsecutiveFailures(), 1)
+	assert.True(t, errors.Is(result.LastError(), context.DeadlineExceeded))
+}
+
+func TestStopInterruptsPollStartedByRefresh(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockBlockingSplitio{started: make(chan bool, 10), release: make(chan bool)}
+	result := NewPoller(testKey, 300, false, mockSplitioDataGetter)
+	started := make(chan error)
+	go func() { started <- result.StartContext(context.Background()) }()
+	<-mockSplitioDataGetter.started
+	mockSplitioDataGetter.release <- true
+	<-started
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- result.Refresh(context.Background()) }()
+	<-mockSplitioDataGetter.started
+
+	// Act
+	result.Stop()
+
+	// Validate that the poll started by Refresh is interrupted without reporting an error
+	select {
+	case err := <-refreshed:
+		assert.Equal(t, err, context.Canceled)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Stop did not interrupt the poll started by Refresh")
+	}
+	assert.Len(t, result.Error, 0)
+	assert.Equal(t, result.ConsecutiveFailures(), 0)
+}
+
+func TestRefreshAfterStopAndRestartIsNotInterrupted(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 300, false, &mockContextSplitio{mockIncrementalSplitio{mockSplitio: mockSplitio{getSplitValid: true}}})
+	for i := 0; i < 100; i++ {
+		result.Start()
+		result.Stop()
+	}
+	result.cancelRunningPoll()
+
+	// Act
+	errAfterStop := result.Refresh(context.Background())
+	result.Start()
+	defer result.Stop()
+	errAfterRestart := result.Refresh(context.Background())
+
+	// Validate that interrupting polls while stopping does not outlive the stop
+	assert.Nil(t, errAfterStop)
+	assert.Nil(t, errAfterRestart)
+	assert.Equal(t, result.ConsecutiveFailures(), 0)
+}
+
 func TestJobsUpdatesCache(t *testing.T) {
 	// Arrange
 	pollingRateSeconds := 1
@@ -176,12 +717,12 @@ func TestJobsUpdatesCache(t *testing.T) {
 	cacheBeforeStart := result.getSplitData()
 	assert.Equal(t, cacheBeforeStart.Since, int64(0))
 	assert.Equal(t, cacheBeforeStart.UsingSegmentsCount, 0)
-	go result.jobs()
+	result.Start()
 	time.Sleep(2 * time.Second)
 	cacheAfterStart := result.getSplitData()
 	assert.True(t, cacheAfterStart.Since > 0)
 	assert.True(t, cacheAfterStart.UsingSegmentsCount > 0)
-	result.quit <- true
+	result.Stop()
 }
 
 func TestJobsStopsWhenQuit(t *testing.T) {
@@ -192,13 +733,13 @@ func TestJobsStopsWhenQuit(t *testing.T) {
 	result := NewPoller(testKey, pollingRateSeconds, false,
 		&mockSplitio{getSplitValid: true})
 
-	// Validate that Jobs stop if quit is set to true
+	// Validate that Jobs stop when Stop is called
 	cacheBeforeStart := result.getSplitData()
 	assert.Equal(t, cacheBeforeStart.Since, int64(0))
-	go result.jobs()
+	result.Start()
 	time.Sleep(2 * time.Second)
 	assert.True(t, result.getSplitData().Since > 0)
-	result.quit <- true
+	result.Stop()
 	cacheAfterStop := result.getSplitData()
 	time.Sleep(2 * time.Second)
 	assert.Equal(t, cacheAfterStop.Since, result.getSplitData().Since)
@@ -221,7 +762,7 @@ func TestJobsCanRunTwiceAfterStop(t *testing.T) {
 	assert.Equal(t, cacheBeforeStart.Since, int64(0))
 	assert.Equal(t, cacheBeforeStart.UsingSegmentsCount, 0)
 	assert.Equal(t, serializedCacheBeforeStart, emptyCacheLoggingScript)
-	go result.jobs()
+	result.Start()
 	time.Sleep(3 * time.Second)
 
 	// assert loop calls function so cache is updated
@@ -231,7 +772,7 @@ func TestJobsCanRunTwiceAfterStop(t *testing.T) {
 	assert.True(t, cacheAfterStart.UsingSegmentsCount > 0)
 	assert.Equal(t, cacheAfterStart.Splits["mock-split"].Name, "mock-split")
 	assert.Equal(t, cacheAfterStart.Segments["mock-segment"].Name, "mock-segment")
-	expectedSerializedScript := result.generateSerializedData(cacheAfterStart, []string{})
+	expectedSerializedScript := serializeFragments(cacheAfterStart, nil, result.isSerializingSegments(), []string{})
 	assert.Equal(t, serializedCacheAfterStart, expectedSerializedScript)
 	result.Stop()
 
@@ -243,7 +784,7 @@ func TestJobsCanRunTwiceAfterStop(t *testing.T) {
 	assert.Equal(t, result.getSplitData().UsingSegmentsCount, firstCount)
 
 	// Second loop
-	go result.jobs()
+	result.Start()
 	time.Sleep(2 * time.Second)
 
 	// verfify cache is updated due to second loop
@@ -267,7 +808,7 @@ func HelperTestPollforChangesReturnsError(t *testing.T, getSplitValid bool) (*Po
 	assert.Equal(t, cacheBeforeStart, SplitData{})
 	assert.Equal(t, cacheBeforeStart.Since, int64(0))
 	assert.Equal(t, cacheBeforeStart.UsingSegmentsCount, 0)
-	go result.jobs()
+	result.Start()
 	err = <-result.Error
 	if err != nil {
 		hasErr = true
@@ -315,7 +856,7 @@ func TestJobsKeepRunningAfterGettingError(t *testing.T) {
 	assert.Equal(t, cacheBeforeStart.Since, int64(0))
 	assert.Equal(t, cacheBeforeStart.UsingSegmentsCount, 0)
 	assert.Equal(t, serializedCacheBeforeStart, emptyCacheLoggingScript)
-	go result.jobs()
+	result.Start()
 	err = <-result.Error
 	if err != nil {
 		hasErr = true
@@ -330,8 +871,7 @@ func TestJobsKeepRunningAfterGettingError(t *testing.T) {
 	assert.EqualError(t, err, "Error from splitio API when getting splits")
 
 	// after setting getSplit, getSegment to true, jobs is still running and cache is updated
-	mockSplitioDataGetter.getSplitValid = true
-	mockSplitioDataGetter.getSegmentValid = true
+	mockSplitioDataGetter.setValid(true, true)
 	time.Sleep(5 * time.Second)
 	cacheSecondRound := result.getSplitData()
 	serializedCacheSecondRound := result.GetSerializedData([]string{})
@@ -339,11 +879,165 @@ func TestJobsKeepRunningAfterGettingError(t *testing.T) {
 	assert.True(t, cacheSecondRound.UsingSegmentsCount > 0)
 	assert.Equal(t, cacheSecondRound.Splits["mock-split"].Name, "mock-split")
 	assert.Equal(t, cacheSecondRound.Segments["mock-segment"].Name, "mock-segment")
-	expectedSerializedScript := result.generateSerializedData(cacheSecondRound, []string{})
+	expectedSerializedScript := serializeFragments(cacheSecondRound, nil, result.isSerializingSegments(), []string{})
 	assert.Equal(t, serializedCacheSecondRound, expectedSerializedScript)
 	result.Stop()
 }
 
+func TestJobsDefersPollsWhenRateLimited(t *testing.T) {
+	// Arrange
+	pollingRateSeconds := 1
+	mockSplitioDataGetter := &mockRateLimitedSplitio{retryAfter: 3 * time.Second}
+	result := NewPoller(testKey, pollingRateSeconds, false, mockSplitioDataGetter)
+
+	// Act
+	result.Start()
+	err := <-result.Error
+	time.Sleep(2500 * time.Millisecond)
+
+	// Validate that no poll happens until Retry-After has elapsed
+	var rateLimitErr *api.RateLimitError
+	assert.True(t, errors.As(err, &rateLimitErr))
+	assert.True(t, result.isPollDeferred(time.Now()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mockSplitioDataGetter.calls))
+	result.Stop()
+}
+
+func TestReportErrorDoesNotDeferWithoutRetryAfter(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, false, &mockSplitio{})
+	go func() { <-result.Error }()
+
+	// Act
+	result.reportError(&api.RateLimitError{StatusCode: 429, Status: "429 Too Many Requests"})
+
+	// Validate that polls are not deferred when Split.io did not send Retry-After
+	assert.False(t, result.isPollDeferred(time.Now()))
+}
+
+func TestStartDoesNotBlockWhenErrorsAreNotRead(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, serializeSegments, &mockSplitio{getSplitValid: false})
+
+	// Act
+	for i := 0; i < errorChannelSize; i++ {
+		result.poll(context.Background())
+	}
+	result.Start()
+	result.Stop()
+
+	// Validate that errors above the channel capacity are dropped and counted
+	assert.Len(t, result.Error, errorChannelSize)
+	assert.Equal(t, result.DroppedErrors(), uint64(1))
+	assert.Equal(t, result.ConsecutiveFailures(), errorChannelSize+1)
+	assert.EqualError(t, result.LastError(), "Error from splitio API when getting splits")
+}
+
+func TestSetErrorHandlerReceivesErrors(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, serializeSegments, &mockSplitio{getSplitValid: false})
+	handledErrors := make(chan error, 2)
+	result.SetErrorHandler(func(err error) {
+		handledErrors <- err
+	})
+
+	// Act
+	result.poll(context.Background())
+	result.poll(context.Background())
+
+	// Validate that errors are passed to the handler instead of the Error channel
+	<-handledErrors
+	assert.EqualError(t, <-handledErrors, "Error from splitio API when getting splits")
+	assert.Len(t, result.Error, 0)
+	assert.Equal(t, result.DroppedErrors(), uint64(0))
+}
+
+func TestStopFromErrorHandler(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, false, &mockSplitio{getSplitValid: false})
+	stopped := make(chan bool, 1)
+	result.SetErrorHandler(func(err error) {
+		result.Stop()
+		stopped <- true
+	})
+
+	// Act
+	result.Start()
+
+	// Validate that the error handler can stop the poller without waiting for itself
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop called from the error handler did not return")
+	}
+	assert.Equal(t, result.State(), StateStopped)
+}
+
+func TestErrorHandlerIsNotBlockedBySubscribers(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockSplitio{getSplitValid: true}
+	result := NewPoller(testKey, 1, false, mockSplitioDataGetter)
+	handledErrors := make(chan error, 1)
+	result.SetErrorHandler(func(err error) { handledErrors <- err })
+	release := make(chan bool)
+	defer close(release)
+	result.Subscribe(func(event ChangeEvent) { <-release })
+	result.poll(context.Background())
+
+	// Act
+	mockSplitioDataGetter.setValid(false, false)
+	result.poll(context.Background())
+
+	// Validate that a stuck subscriber does not delay the error handler
+	select {
+	case err := <-handledErrors:
+		assert.EqualError(t, err, "Error from splitio API when getting splits")
+	case <-time.After(time.Second):
+		t.Fatal("the error handler was blocked by a subscriber")
+	}
+}
+
+func TestErrorHandlerQueueDropsErrorsWhenFull(t *testing.T) {
+	// Arrange
+	result := NewPoller(testKey, 1, false, &mockSplitio{})
+	started := make(chan bool, errorChannelSize+2)
+	release := make(chan bool)
+	result.SetErrorHandler(func(err error) {
+		started <- true
+		<-release
+	})
+	result.reportError(errors.New("mock error"))
+	<-started
+
+	// Act
+	for i := 0; i < errorChannelSize+1; i++ {
+		result.reportError(errors.New("mock error"))
+	}
+
+	// Validate that errors above the queue capacity are dropped and counted
+	assert.Equal(t, result.DroppedErrors(), uint64(1))
+	close(release)
+}
+
+func TestSuccessfulPollResetsConsecutiveFailures(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockSplitio{getSplitValid: false}
+	result := NewPoller(testKey, 1, serializeSegments, mockSplitioDataGetter)
+	result.SetErrorHandler(func(err error) {})
+	result.poll(context.Background())
+	result.poll(context.Background())
+	failuresBeforeSuccess := result.ConsecutiveFailures()
+
+	// Act
+	mockSplitioDataGetter.setValid(true, true)
+	result.poll(context.Background())
+
+	// Validate that the last error is kept after a successful poll
+	assert.Equal(t, failuresBeforeSuccess, 2)
+	assert.Equal(t, result.ConsecutiveFailures(), 0)
+	assert.EqualError(t, result.LastError(), "Error from splitio API when getting splits")
+}
+
 func TestGetSerializedDataWithSplitNamesPassedIn(t *testing.T) {
 	// Arrange
 	splitNames := []string{"mock-split-2"}
@@ -357,10 +1051,10 @@ func TestGetSerializedDataWithSplitNamesPassedIn(t *testing.T) {
 	// Validate that GetSerializedData returns serialized data subset properly
 
 	// before start, cached serialized subsets should be an empty logging script for the subset and the serialized data returned should be an empty logging script
-	serializedCachedDataSubsetsBeforeStart := result.getCachedSerializedDataSubsets()
 	subsetBeforeStart := result.GetSerializedData(splitNames)
+	serializedCachedDataSubsetsBeforeStart := result.subsets.serializedDataSubsets()
 	assert.Equal(t, serializedCachedDataSubsetsBeforeStart, map[string]string{
-		"mock-split-2": emptyCacheLoggingScript,
+		`["mock-split-2"]`: emptyCacheLoggingScript,
 	})
 	assert.Equal(t, subsetBeforeStart, emptyCacheLoggingScript)
 
@@ -369,45 +1063,46 @@ func TestGetSerializedDataWithSplitNamesPassedIn(t *testing.T) {
 
 	// after starting, cached serialized subsets should contain a valid logging script
 	cacheSplitData := result.getSplitData()
-	serializedCachedDataSubsetsAfterStart := result.getCachedSerializedDataSubsets()
+	serializedCachedDataSubsetsAfterStart := result.subsets.serializedDataSubsets()
 	subsetAfterStart := result.GetSerializedData(splitNames)
-	expectedSerializedScript := result.generateSerializedData(cacheSplitData, splitNames)
+	expectedSerializedScript := serializeFragments(cacheSplitData, nil, result.isSerializingSegments(), splitNames)
 	assert.Equal(t, serializedCachedDataSubsetsAfterStart, map[string]string{
-		"mock-split-2": expectedSerializedScript,
+		`["mock-split-2"]`: expectedSerializedScript,
 	})
 	assert.Equal(t, subsetAfterStart, expectedSerializedScript)
-	result.quit <- true
+	result.Stop()
 }
 
-func TestGetUpdatedSerializedDataSubsetsValid(t *testing.T) {
+func TestUpdateSerializedDataSubsetsValid(t *testing.T) {
 	// Arrange
-	deterministic := true
 	mockSince := int64(1)
-	mockUsingSegmentsCount := 3
 	mockSplitData := SplitData{
 		Splits:             mockMultipleSplits,
 		Since:              mockSince,
 		Segments:           mockSegments,
 		UsingSegmentsCount: 2,
 	}
-	serializedDataSubsets := map[string]string{
-		"mock-split-1.mock-split-2":              "",
-		"mock-split-1.mock-split-2.mock-split-3": "",
-		"mock-split-2":                           "",
-	}
 	poller := NewPoller(testKey, 1, serializeSegments,
-		&mockSplitio{mockUsingSegmentsCount: mockUsingSegmentsCount, getSplitValid: true, getSegmentValid: true, deterministic: deterministic})
+		&mockSplitio{getSplitValid: true, getSegmentValid: true, deterministic: true})
+	previousCache := poller.getCache()
+	for _, splitNames := range [][]string{{"mock-split-1", "mock-split-2"}, {"mock-split-1", "mock-split-2", "mock-split-3"}, {"mock-split-2"}} {
+		key, uniqueSplitNames := subsetKey(splitNames)
+		poller.subsets.set(key, uniqueSplitNames, previousCache, "")
+	}
 	cache := Cache{
-		splitData:             mockSplitData,
-		serializedData:        poller.GetSerializedData([]string{}),
-		serializedDataSubsets: serializedDataSubsets,
+		version:           previousCache.version + 1,
+		splitData:         mockSplitData,
+		serializedData:    serializeFragments(mockSplitData, nil, poller.isSerializingSegments(), []string{}),
+		serializeSegments: poller.isSerializingSegments(),
 	}
-	atomic.StorePointer(&poller.cache, unsafe.Pointer(&cache))
 
 	// Act
-	result := poller.getUpdatedSerializedDataSubsets(mockSplitData)
+	poller.updateSerializedDataSubsets(&cache)
+	atomic.StorePointer(&poller.cache, unsafe.Pointer(&cache))
+	result := poller.subsets.serializedDataSubsets()
 
 	// Validate that an updated serializedDataSubsets, with correct logging scripts, is returned
+	// and that no segments are serialized since the splits do not use any
 	stringSplit := `"mock-split-%v":"{\"changeNumber\":0,\"trafficTypeName\":\"\",\"name\":\"mock-split-%v\",\"trafficAllocation\":0,\"trafficAllocationSeed\":0,\"seed\":0,\"status\":\"mock-status-%v\",\"killed\":false,\"defaultTreatment\":\"\",\"algo\":0,\"conditions\":null,\"configurations\":null}"`
 	mockSplitOneString := fmt.Sprintf(stringSplit, 1, 1, 1)
 	mockSplitTwoString := fmt.Sprintf(stringSplit, 2, 2, 2)
@@ -417,12 +1112,180 @@ func TestGetUpdatedSerializedDataSubsetsValid(t *testing.T) {
 	thirdSplitDataString := fmt.Sprintf(`{%v}`, mockSplitTwoString)
 
 	expectedUpdatedSerializedDataSubsets := map[string]string{
-		"mock-split-1.mock-split-2":              fmt.Sprintf(formattedLoggingScript, firstSplitDataString, mockSince, stringSegmentsMockSplitIo, mockUsingSegmentsCount),
-		"mock-split-1.mock-split-2.mock-split-3": fmt.Sprintf(formattedLoggingScript, secondSplitDataString, mockSince, stringSegmentsMockSplitIo, mockUsingSegmentsCount),
-		"mock-split-2":                           fmt.Sprintf(formattedLoggingScript, thirdSplitDataString, mockSince, stringSegmentsMockSplitIo, mockUsingSegmentsCount),
+		`["mock-split-1","mock-split-2"]`:                fmt.Sprintf(formattedLoggingScript, firstSplitDataString, mockSince, "{}", 0),
+		`["mock-split-1","mock-split-2","mock-split-3"]`: fmt.Sprintf(formattedLoggingScript, secondSplitDataString, mockSince, "{}", 0),
+		`["mock-split-2"]`:                               fmt.Sprintf(formattedLoggingScript, thirdSplitDataString, mockSince, "{}", 0),
 	}
 	assert.Equal(t, result, expectedUpdatedSerializedDataSubsets)
+	assert.Equal(t, poller.GetSerializedData([]string{"mock-split-2"}), expectedUpdatedSerializedDataSubsets[`["mock-split-2"]`])
+}
+
+func TestGetSerializedDataIsSafeForConcurrentUse(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, serializeSegments,
+		&mockSplitio{mockSince: 10, getSplitValid: true, getSegmentValid: true, deterministic: true})
+	subsets := [][]string{
+		{"mock-split"},
+		{"mock-split-2"},
+		{"mock-split-3", "mock-split"},
+		{"mock-split-2", "mock-split-3"},
+		{"mock-split", "mock-split-2", "mock-split-3"},
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Act
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					poller.GetSerializedData(subsets[i%len(subsets)])
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 50; i++ {
+		poller.poll(context.Background())
+	}
+	close(done)
+	wg.Wait()
+
+	// Validate that every subset is served from the latest cache
+	cacheSplitData := poller.getSplitData()
+	for _, splitNames := range subsets {
+		sortedSplitNames := append([]string{}, splitNames...)
+		sort.Strings(sortedSplitNames)
+		assert.Equal(t, poller.GetSerializedData(splitNames), serializeFragments(cacheSplitData, nil, poller.isSerializingSegments(), sortedSplitNames))
+	}
+	assert.Len(t, poller.subsets.serializedDataSubsets(), len(subsets))
 }
+
+func TestSubsetCacheLimitsBoundCachedSubsets(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, serializeSegments,
+		&mockSplitio{mockSince: 10, getSplitValid: true, getSegmentValid: true, deterministic: true})
+	poller.SetSubsetCacheLimits(2, 0)
+	poller.poll(context.Background())
+
+	// Act
+	poller.GetSerializedData([]string{"mock-split"})
+	poller.GetSerializedData([]string{"mock-split-2"})
+	poller.GetSerializedData([]string{"mock-split"})
+	poller.GetSerializedData([]string{"mock-split-3"})
+	poller.poll(context.Background())
+
+	// Validate that the least recently used subset was evicted and the others were regenerated by the poll
+	cacheSplitData := poller.getSplitData()
+	assert.Equal(t, poller.subsets.serializedDataSubsets(), map[string]string{
+		`["mock-split"]`:   serializeFragments(cacheSplitData, nil, poller.isSerializingSegments(), []string{"mock-split"}),
+		`["mock-split-3"]`: serializeFragments(cacheSplitData, nil, poller.isSerializingSegments(), []string{"mock-split-3"}),
+	})
+	assert.Equal(t, poller.SubsetCacheStats(), SubsetCacheStats{Hits: 1, Misses: 3, Evictions: 1, Size: 2})
+}
+
+func TestGetSerializedDataWithDottedSplitNamesSurvivesPolls(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, serializeSegments,
+		&mockSplitio{getSplitValid: true, getSegmentValid: true, deterministic: true})
+	splitData := SplitData{
+		Splits: map[string]dtos.SplitDTO{
+			"checkout.v2": {Name: "checkout.v2"},
+			"checkout":    {Name: "checkout"},
+			"v2":          {Name: "v2"},
+		},
+		Since: 1,
+	}
+	cache := Cache{version: 1, splitData: splitData, serializeSegments: poller.isSerializingSegments()}
+	atomic.StorePointer(&poller.cache, unsafe.Pointer(&cache))
+	subsetBeforePoll := poller.GetSerializedData([]string{"checkout.v2", "checkout.v2"})
+
+	// Act
+	updatedSplitData := splitData
+	updatedSplitData.Since = 2
+	updatedCache := Cache{version: 2, splitData: updatedSplitData, serializeSegments: poller.isSerializingSegments()}
+	poller.updateSerializedDataSubsets(&updatedCache)
+	atomic.StorePointer(&poller.cache, unsafe.Pointer(&updatedCache))
+
+	// Validate that the subset still only contains checkout.v2 after the poll, and duplicates share one subset
+	assert.Equal(t, subsetBeforePoll, serializeFragments(splitData, nil, poller.isSerializingSegments(), []string{"checkout.v2"}))
+	assert.Equal(t, poller.GetSerializedData([]string{"checkout.v2"}), serializeFragments(updatedSplitData, nil, poller.isSerializingSegments(), []string{"checkout.v2"}))
+	assert.NotEqual(t, poller.GetSerializedData([]string{"checkout", "v2"}), poller.GetSerializedData([]string{"checkout.v2"}))
+	assert.Equal(t, poller.SubsetCacheStats(), SubsetCacheStats{Hits: 2, Misses: 2, Size: 2})
+}
+
+// failingWriter fails once more than limit bytes are written to it
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+func (writer *failingWriter) Write(p []byte) (int, error) {
+	if writer.written+len(p) > writer.limit {
+		return 0, errors.New("write failed")
+	}
+	writer.written += len(p)
+	return len(p), nil
+}
+
+func TestWriteSerializedDataWritesGetSerializedData(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, serializeSegments,
+		&mockSplitio{mockSince: 10, mockUsingSegmentsCount: 10, getSplitValid: true, getSegmentValid: true, deterministic: true})
+	poller.poll(context.Background())
+	var fullData, subsetData strings.Builder
+
+	// Act
+	fullWritten, fullErr := poller.WriteSerializedData(&fullData, []string{})
+	subsetWritten, subsetErr := poller.WriteSerializedData(&subsetData, []string{"mock-split-2", "mock-split"})
+
+	// Validate that the streamed subset was cached and is the same as GetSerializedData
+	assert.Nil(t, fullErr)
+	assert.Nil(t, subsetErr)
+	assert.Equal(t, fullData.String(), poller.GetSerializedData([]string{}))
+	assert.Equal(t, fullWritten, int64(fullData.Len()))
+	assert.Equal(t, subsetWritten, int64(subsetData.Len()))
+	assert.Equal(t, poller.subsets.serializedDataSubsets(), map[string]string{
+		`["mock-split","mock-split-2"]`: subsetData.String(),
+	})
+	assert.Equal(t, subsetData.String(), poller.GetSerializedData([]string{"mock-split", "mock-split-2"}))
+	assert.Equal(t, poller.SubsetCacheStats(), SubsetCacheStats{Hits: 1, Misses: 1, Size: 1})
+}
+
+func TestWriteSerializedDataBeforeFirstPoll(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, serializeSegments, &mockSplitio{})
+	var result strings.Builder
+
+	// Act
+	written, err := poller.WriteSerializedData(&result, []string{"mock-split"})
+
+	// Validate
+	assert.Nil(t, err)
+	assert.Equal(t, written, int64(len(emptyCacheLoggingScript)))
+	assert.Equal(t, result.String(), emptyCacheLoggingScript)
+}
+
+func TestWriteSerializedDataReturnsWriterError(t *testing.T) {
+	// Arrange
+	poller := NewPoller(testKey, 1, serializeSegments,
+		&mockSplitio{getSplitValid: true, getSegmentValid: true, deterministic: true})
+	poller.poll(context.Background())
+	writer := &failingWriter{limit: 64}
+
+	// Act
+	written, err := poller.WriteSerializedData(writer, []string{"mock-split"})
+
+	// Validate that the error is returned and the partially written subset is not cached
+	assert.EqualError(t, err, "write failed")
+	assert.Equal(t, written, int64(writer.written))
+	assert.Equal(t, poller.subsets.serializedDataSubsets(), map[string]string{})
+}
+
 func TestGenerateSerializedDataValid(t *testing.T) {
 	// Arrange
 	poller := NewPoller(testKey, 1, serializeSegments,
@@ -440,7 +1303,7 @@ func TestGenerateSerializedDataValid(t *testing.T) {
 		UsingSegmentsCount: 2,
 	}
 	// Act
-	result := poller.generateSerializedData(mockSplitData, []string{})
+	result := serializeFragments(mockSplitData, nil, poller.isSerializingSegments(), []string{})
 
 	// Validate that returned logging script contains a valid SplitData
 	stringSplits := `{"mock-split-1":"{\"changeNumber\":0,\"trafficTypeName\":\"\",\"name\":\"mock-split-1\",\"trafficAllocation\":0,\"trafficAllocationSeed\":0,\"seed\":0,\"status\":\"mock-status-1\",\"killed\":false,\"defaultTreatment\":\"\",\"algo\":0,\"conditions\":null,\"configurations\":null}"}`
@@ -451,10 +1314,8 @@ func TestGenerateSerializedDataValid(t *testing.T) {
 func TestGenerateSerializedDataWithNonEmptySplitNames(t *testing.T) {
 	// Arrange
 	mockSince := int64(1)
-	mockUsingSegmentsCount := 200
-	deterministic := true
 	poller := NewPoller(testKey, 1, serializeSegments,
-		&mockSplitio{mockUsingSegmentsCount: mockUsingSegmentsCount, getSplitValid: true, getSegmentValid: true, deterministic: deterministic})
+		&mockSplitio{getSplitValid: true, getSegmentValid: true, deterministic: true})
 	splitNames := []string{"mock-split-2"}
 	mockSplitData := SplitData{
 		Splits:             mockMultipleSplits,
@@ -464,13 +1325,52 @@ func TestGenerateSerializedDataWithNonEmptySplitNames(t *testing.T) {
 	}
 
 	// Act
-	result := poller.generateSerializedData(mockSplitData, splitNames)
+	result := serializeFragments(mockSplitData, nil, poller.isSerializingSegments(), splitNames)
 
 	// Validate that returned logging script only contains SplitData for splits passed in,
-	// that segments data is from the mocked GetSegmentsForSplits response,
-	// and that the usingSegmentsCount is our mocked value
+	// and that segmentsData and usingSegmentsCount only account for the splits passed in, which use no segment
 	stringSplits := `{"mock-split-2":"{\"changeNumber\":0,\"trafficTypeName\":\"\",\"name\":\"mock-split-2\",\"trafficAllocation\":0,\"trafficAllocationSeed\":0,\"seed\":0,\"status\":\"mock-status-2\",\"killed\":false,\"defaultTreatment\":\"\",\"algo\":0,\"conditions\":null,\"configurations\":null}"}`
-	expectedLoggingScript := fmt.Sprintf(formattedLoggingScript, stringSplits, mockSince, stringSegmentsMockSplitIo, mockUsingSegmentsCount)
+	expectedLoggingScript := fmt.Sprintf(formattedLoggingScript, stringSplits, mockSince, "{}", 0)
+	assert.Equal(t, result, expectedLoggingScript)
+}
+
+func TestGenerateSerializedDataWithNonEmptySplitNamesUsesCachedSegments(t *testing.T) {
+	// Arrange
+	mockSince := int64(1)
+	poller := NewPoller(testKey, 1, serializeSegments,
+		&mockSplitio{getSplitValid: true, getSegmentValid: false})
+	segmentMatcher := dtos.MatcherDTO{
+		MatcherType:        "IN_SEGMENT",
+		UserDefinedSegment: &dtos.UserDefinedSegmentMatcherDataDTO{SegmentName: "mock-segment-1"},
+	}
+	splitUsingSegment := dtos.SplitDTO{
+		Name:       "mock-split-using-segment",
+		Conditions: []dtos.ConditionDTO{{MatcherGroup: dtos.MatcherGroupDTO{Matchers: []dtos.MatcherDTO{segmentMatcher}}}},
+	}
+	mockSplitData := SplitData{
+		Splits: map[string]dtos.SplitDTO{
+			"mock-split-1":             mockMultipleSplits["mock-split-1"],
+			"mock-split-using-segment": splitUsingSegment,
+		},
+		Since: mockSince,
+		Segments: map[string]dtos.SegmentChangesDTO{
+			"mock-segment-1": mockSegments["mock-segment-1"],
+			"mock-segment-2": {Name: "mock-segment-2"},
+		},
+		UsingSegmentsCount: 2,
+	}
+
+	// Act
+	result := serializeFragments(mockSplitData, nil, poller.isSerializingSegments(), []string{"mock-split-1", "mock-split-using-segment"})
+
+	// Validate that segments used by the subset are taken from the split data without calling Split.io
+	marshalledSplitOne, _ := json.Marshal(mockMultipleSplits["mock-split-1"])
+	marshalledSplitUsingSegment, _ := json.Marshal(splitUsingSegment)
+	stringSplits, _ := json.Marshal(map[string]string{
+		"mock-split-1":             string(marshalledSplitOne),
+		"mock-split-using-segment": string(marshalledSplitUsingSegment),
+	})
+	expectedLoggingScript := fmt.Sprintf(formattedLoggingScript, string(stringSplits), mockSince, stringSegments, 1)
 	assert.Equal(t, result, expectedLoggingScript)
 }
 
@@ -492,7 +1392,7 @@ func TestGenerateSerializedDataWithNonEmptySplitNamesAndFalseSerializeSegments(t
 	}
 
 	// Act
-	result := poller.generateSerializedData(mockSplitData, splitNames)
+	result := serializeFragments(mockSplitData, nil, poller.isSerializingSegments(), splitNames)
 
 	// Validate that returned logging script only contains SplitData for splits passed in,
 	// and that there is an empty segmentsData and zero usingSegmentsCount
@@ -502,26 +1402,6 @@ func TestGenerateSerializedDataWithNonEmptySplitNamesAndFalseSerializeSegments(t
 	assert.Equal(t, result, expectedLoggingScript)
 }
 
-func TestGenerateSerializedDataWithNonEmptySplitNamesAndInvalidSegmentsReturnsEmptyScript(t *testing.T) {
-	// Arrange
-	getSegmentValid := false
-	poller := NewPoller(testKey, 1, serializeSegments,
-		&mockSplitio{getSplitValid: true, getSegmentValid: getSegmentValid})
-	splitNames := []string{"mock-split-2"}
-	mockSplitData := SplitData{
-		Splits:             mockMultipleSplits,
-		Since:              1,
-		Segments:           mockSegments,
-		UsingSegmentsCount: 2,
-	}
-
-	// Act
-	result := poller.generateSerializedData(mockSplitData, splitNames)
-
-	// Validate that output is an empty logging script
-	assert.Equal(t, result, emptyCacheLoggingScript)
-}
-
 func TestGenerateSerializedDataWithInvalidSplitsReturnsNoSplitsData(t *testing.T) {
 	// Arrange
 	poller := NewPoller(testKey, 1, serializeSegments,
@@ -535,11 +1415,11 @@ func TestGenerateSerializedDataWithInvalidSplitsReturnsNoSplitsData(t *testing.T
 	}
 
 	// Act
-	result := poller.generateSerializedData(mockSplitData, splitNames)
+	result := serializeFragments(mockSplitData, nil, poller.isSerializingSegments(), splitNames)
 
-	// Validate that returned logging script does not contain any splits data
+	// Validate that returned logging script does not contain any splits or segments data
 	emptySplits := "{}"
-	expectedLoggingScript := fmt.Sprintf(formattedLoggingScript, emptySplits, 1, stringSegmentsMockSplitIo, 1)
+	expectedLoggingScript := fmt.Sprintf(formattedLoggingScript, emptySplits, 1, "{}", 0)
 	assert.Equal(t, result, expectedLoggingScript)
 }
 
@@ -549,7 +1429,7 @@ func TestGenerateSerializedDataMarshalEmptyCache(t *testing.T) {
 		&mockSplitio{getSplitValid: true, getSegmentValid: true})
 
 	// Act
-	result := poller.generateSerializedData(SplitData{}, []string{})
+	result := serializeFragments(SplitData{}, nil, poller.isSerializingSegments(), []string{})
 
 	// Validate that returned logging script contains a valid SplitData
 	expectedLoggingScript := fmt.Sprint(emptyCacheLoggingScript)
@@ -562,7 +1442,7 @@ func TestGenerateSerializedDataSplitError(t *testing.T) {
 		&mockSplitio{getSplitValid: true, getSegmentValid: true})
 
 	// Act
-	result := poller.generateSerializedData(SplitData{}, []string{})
+	result := serializeFragments(SplitData{}, nil, poller.isSerializingSegments(), []string{})
 
 	// Validate that returned logging script contains a valid SplitData
 	expectedLoggingScript := fmt.Sprint(emptyCacheLoggingScript)
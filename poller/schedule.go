@@ -0,0 +1,73 @@
+package poller
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// SchedulePolicy controls the delay between two polls
+type SchedulePolicy struct {
+	// Jitter is the fraction, between 0 and 1, by which each delay is randomly increased or decreased,
+	// so that pollers started together do not poll Split.io in lockstep. It is clamped to this range.
+	Jitter float64
+	// MaxBackoff caps the delay after failed polls. After each consecutive failure, the polling interval
+	// is doubled up to MaxBackoff. No backoff is applied when zero, which is the default.
+	MaxBackoff time.Duration
+	// CatchUpInterval is the delay after the first successful poll following failures,
+	// the polling interval is used when zero
+	CatchUpInterval time.Duration
+}
+
+// DefaultSchedulePolicy returns the SchedulePolicy used when none is provided
+func DefaultSchedulePolicy() SchedulePolicy {
+	return SchedulePolicy{
+		Jitter: 0.1,
+	}
+}
+
+// clamped returns the policy with Jitter limited to the range between 0 and 1
+func (policy SchedulePolicy) clamped() SchedulePolicy {
+	policy.Jitter = math.Max(0, math.Min(policy.Jitter, 1))
+	return policy
+}
+
+// delay returns how long to wait before the next poll, given the polling interval,
+// the number of consecutive failed polls and whether the last poll recovered from failures
+func (policy SchedulePolicy) delay(interval time.Duration, failures int, recovered bool) time.Duration {
+	delay := interval
+	if failures > 0 && policy.MaxBackoff > interval {
+		for i := 0; i < failures && delay < policy.MaxBackoff; i++ {
+			delay *= 2
+		}
+		if delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	} else if failures == 0 && recovered && policy.CatchUpInterval > 0 {
+		delay = policy.CatchUpInterval
+	}
+	if policy.Jitter > 0 {
+		delay += time.Duration(float64(delay) * policy.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+// SetSchedulePolicy sets how the delay between two polls is computed, defaults to DefaultSchedulePolicy().
+// It applies from the next poll.
+func (poller *Poller) SetSchedulePolicy(policy SchedulePolicy) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	poller.schedulePolicy = policy.clamped()
+}
+
+// nextPollDelay returns how long to wait at the time now before the next poll, which is never
+// before the end of the delay asked by Split.io when it rate limited a request
+func (poller *Poller) nextPollDelay(now time.Time, recovered bool) time.Duration {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	delay := poller.schedulePolicy.delay(poller.pollingInterval, poller.failures, recovered)
+	if deferral := poller.pollDeferredUntil.Sub(now); deferral > delay {
+		delay = deferral
+	}
+	return delay
+}
@@ -0,0 +1,229 @@
+package poller
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/splitio/go-split-commons/dtos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulePolicyDelayWithoutFailures(t *testing.T) {
+	// Arrange
+	policy := SchedulePolicy{MaxBackoff: time.Minute, CatchUpInterval: time.Second}
+
+	// Validate that the polling interval is used while polls succeed
+	assert.Equal(t, policy.delay(10*time.Second, 0, false), 10*time.Second)
+}
+
+func TestSchedulePolicyDelayBacksOffAfterFailures(t *testing.T) {
+	// Arrange
+	policy := SchedulePolicy{MaxBackoff: time.Minute}
+
+	// Validate that the delay doubles on every failure until it reaches MaxBackoff
+	assert.Equal(t, policy.delay(10*time.Second, 1, false), 20*time.Second)
+	assert.Equal(t, policy.delay(10*time.Second, 2, false), 40*time.Second)
+	assert.Equal(t, policy.delay(10*time.Second, 3, false), time.Minute)
+	assert.Equal(t, policy.delay(10*time.Second, 100, false), time.Minute)
+}
+
+func TestSchedulePolicyDelayWithoutMaxBackoff(t *testing.T) {
+	// Arrange
+	policy := SchedulePolicy{}
+
+	// Validate that failures are retried at the polling interval when MaxBackoff is zero
+	assert.Equal(t, policy.delay(10*time.Second, 5, false), 10*time.Second)
+}
+
+func TestSchedulePolicyDelayCatchesUpAfterRecovery(t *testing.T) {
+	// Arrange
+	policy := SchedulePolicy{MaxBackoff: time.Minute, CatchUpInterval: time.Second}
+
+	// Validate
+	assert.Equal(t, policy.delay(10*time.Second, 0, true), time.Second)
+}
+
+func TestSchedulePolicyDelayAppliesJitter(t *testing.T) {
+	// Arrange
+	policy := SchedulePolicy{Jitter: 0.5}
+
+	// Validate that the delay stays within the jitter bounds and varies
+	delays := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := policy.delay(2*time.Second, 0, false)
+		assert.True(t, delay >= time.Second)
+		assert.True(t, delay <= 3*time.Second)
+		delays[delay] = true
+	}
+	assert.True(t, len(delays) > 1)
+}
+
+func TestSetSchedulePolicyClampsJitter(t *testing.T) {
+	// Arrange
+	poller := NewPollerWithOptions(testKey, WithSplitio(&mockSplitio{}), WithPollingInterval(time.Second),
+		WithSchedulePolicy(SchedulePolicy{Jitter: 3}))
+	jitterFromOption := poller.schedulePolicy.Jitter
+
+	// Act
+	poller.SetSchedulePolicy(SchedulePolicy{Jitter: -1})
+
+	// Validate that the jitter is limited to the range between 0 and 1, so delays are never negative
+	assert.Equal(t, jitterFromOption, float64(1))
+	assert.Equal(t, poller.schedulePolicy.Jitter, float64(0))
+	poller.SetSchedulePolicy(SchedulePolicy{Jitter: 3})
+	for i := 0; i < 100; i++ {
+		assert.True(t, poller.nextPollDelay(time.Now(), false) >= 0)
+	}
+}
+
+func TestNextPollDelayWaitsForRetryAfter(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	poller := NewPollerWithOptions(testKey, WithSplitio(&mockSplitio{}), WithPollingInterval(time.Second),
+		WithSchedulePolicy(SchedulePolicy{}))
+	poller.pollDeferredUntil = now.Add(time.Minute)
+
+	// Validate that the next poll is not before Retry-After has elapsed
+	assert.Equal(t, poller.nextPollDelay(now, false), time.Minute)
+	assert.Equal(t, poller.nextPollDelay(now.Add(2*time.Minute), false), time.Second)
+}
+
+func TestJobsBackOffAfterFailures(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockRateLimitedSplitio{}
+	poller := NewPollerWithOptions(testKey,
+		WithSplitio(mockSplitioDataGetter),
+		WithPollingInterval(100*time.Millisecond),
+		WithSchedulePolicy(SchedulePolicy{MaxBackoff: 400 * time.Millisecond}),
+		WithErrorHandler(func(err error) {}),
+	)
+
+	// Act
+	poller.Start()
+	time.Sleep(1100 * time.Millisecond)
+	poller.Stop()
+
+	// Validate that polls happened at 0, 200, 600 and 1000 ms instead of every 100 ms
+	assert.Equal(t, int32(4), atomic.LoadInt32(&mockSplitioDataGetter.calls))
+}
+
+func TestSetPollingIntervalReschedulesNextPoll(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockRateLimitedSplitio{}
+	poller := NewPollerWithOptions(testKey,
+		WithSplitio(mockSplitioDataGetter),
+		WithPollingInterval(time.Hour),
+		WithSchedulePolicy(SchedulePolicy{}),
+		WithErrorHandler(func(err error) {}),
+	)
+	poller.Start()
+	defer poller.Stop()
+
+	// Act
+	poller.SetPollingInterval(100 * time.Millisecond)
+	time.Sleep(350 * time.Millisecond)
+
+	// Validate that polls happen at the new interval without waiting for the previous one
+	assert.True(t, atomic.LoadInt32(&mockSplitioDataGetter.calls) >= 3)
+	assert.Equal(t, poller.getPollTimeout(), 100*time.Millisecond)
+}
+
+func TestSetPollingIntervalIgnoresInvalidInterval(t *testing.T) {
+	// Arrange
+	poller := NewPollerWithOptions(testKey, WithSplitio(&mockSplitio{}), WithPollingInterval(time.Minute))
+
+	// Act
+	poller.SetPollingInterval(0)
+
+	// Validate
+	assert.Equal(t, poller.pollingInterval, time.Minute)
+}
+
+func TestSetSerializeSegmentsPollsImmediately(t *testing.T) {
+	// Arrange
+	poller := NewPollerWithOptions(testKey,
+		WithSplitio(&mockSplitio{getSplitValid: true, getSegmentValid: true, deterministic: true}),
+		WithPollingInterval(time.Hour),
+	)
+	poller.Start()
+	defer poller.Stop()
+	segmentsBeforeToggle := poller.getSplitData().Segments
+
+	// Act
+	poller.SetSerializeSegments(true)
+	time.Sleep(100 * time.Millisecond)
+
+	// Validate that the cached splits now have their segments
+	assert.Empty(t, segmentsBeforeToggle)
+	assert.Equal(t, poller.getSplitData().Segments["mock-segment"].Name, "mock-segment")
+
+	// Act
+	poller.SetSerializeSegments(false)
+	time.Sleep(100 * time.Millisecond)
+
+	// Validate that the segments are no longer cached
+	assert.Empty(t, poller.getSplitData().Segments)
+}
+
+func TestSetSerializeSegmentsDoesNotPollWhenNotRunning(t *testing.T) {
+	// Arrange
+	mockSplitioDataGetter := &mockRateLimitedSplitio{}
+	poller := NewPollerWithOptions(testKey, WithSplitio(mockSplitioDataGetter), WithPollingInterval(time.Hour),
+		WithErrorHandler(func(err error) {}))
+
+	// Act
+	poller.SetSerializeSegments(true)
+	poller.Start()
+	defer poller.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	// Validate that only the initial poll of Start was made
+	assert.True(t, poller.isSerializingSegments())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mockSplitioDataGetter.calls))
+}
+
+// mockSegmentSplitio returns a split using a segment and a split using none
+type mockSegmentSplitio struct{}
+
+func (splitio *mockSegmentSplitio) GetSplits() (map[string]dtos.SplitDTO, int64, error) {
+	matcher := dtos.MatcherDTO{
+		MatcherType:        "IN_SEGMENT",
+		UserDefinedSegment: &dtos.UserDefinedSegmentMatcherDataDTO{SegmentName: "mock-segment"},
+	}
+	condition := dtos.ConditionDTO{MatcherGroup: dtos.MatcherGroupDTO{Matchers: []dtos.MatcherDTO{matcher}}}
+	return map[string]dtos.SplitDTO{
+		"mock-split":   {Name: "mock-split", Conditions: []dtos.ConditionDTO{condition}},
+		"mock-split-2": {Name: "mock-split-2"},
+	}, 1, nil
+}
+
+func (splitio *mockSegmentSplitio) GetSegmentsForSplits(splits map[string]dtos.SplitDTO) (map[string]dtos.SegmentChangesDTO, int, error) {
+	return map[string]dtos.SegmentChangesDTO{
+		"mock-segment": {Name: "mock-segment", Added: []string{"foo"}, Since: 1, Till: 1},
+	}, 1, nil
+}
+
+func TestSetSerializeSegmentsKeepsSubsetsConsistentUntilNextPoll(t *testing.T) {
+	// Arrange
+	poller := NewPollerWithOptions(testKey, WithSplitio(&mockSegmentSplitio{}), WithPollingInterval(time.Hour))
+	poller.poll(context.Background())
+
+	// Act
+	poller.SetSerializeSegments(true)
+	subsetAfterToggleOn := poller.GetSerializedData([]string{"mock-split"})
+	poller.poll(context.Background())
+	subsetAfterPollWithSegments := poller.GetSerializedData([]string{"mock-split"})
+	poller.SetSerializeSegments(false)
+	subsetAfterToggleOff := poller.GetSerializedData([]string{"mock-split-2"})
+	poller.poll(context.Background())
+	subsetAfterPollWithoutSegments := poller.GetSerializedData([]string{"mock-split"})
+
+	// Validate that subsets are serialized the way the cached split data was fetched, not the current setting
+	assert.Contains(t, subsetAfterToggleOn, "segmentsData: {}, usingSegmentsCount: 0")
+	assert.Contains(t, subsetAfterPollWithSegments, `segmentsData: {"mock-segment"`)
+	assert.Contains(t, subsetAfterPollWithSegments, "usingSegmentsCount: 1")
+	assert.Contains(t, subsetAfterToggleOff, "segmentsData: {}, usingSegmentsCount: 0")
+	assert.Contains(t, subsetAfterPollWithoutSegments, "segmentsData: {}, usingSegmentsCount: 0")
+}
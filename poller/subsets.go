@@ -0,0 +1,191 @@
+package poller
+
+import (
+	"container/list"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultMaxSubsets is the number of subsets cached when no limit is configured
+const defaultMaxSubsets = 1000
+
+// SubsetCacheStats contains usage statistics of the cache of serialized data subsets
+type SubsetCacheStats struct {
+	Hits      uint64 // requests served from the cache
+	Misses    uint64 // requests that generated the serialized data
+	Evictions uint64 // subsets removed because the cache was full or they were unused for longer than the TTL
+	Size      int    // subsets currently cached
+}
+
+// subsetKey returns the split names of a subset sorted and without duplicates, and the key identifying the subset.
+// The key is the JSON encoding of the split names, so any split name, e.g. one containing periods, is unambiguous.
+func subsetKey(splitNames []string) (string, []string) {
+	sortedSplitNames := append([]string{}, splitNames...)
+	sort.Strings(sortedSplitNames)
+	uniqueSplitNames := sortedSplitNames[:0]
+	for index, name := range sortedSplitNames {
+		if index == 0 || name != sortedSplitNames[index-1] {
+			uniqueSplitNames = append(uniqueSplitNames, name)
+		}
+	}
+	key, _ := json.Marshal(uniqueSplitNames)
+	return string(key), uniqueSplitNames
+}
+
+// subsetCache contains the serialized data of the subsets of splits requested, and is safe for concurrent use.
+// Each subset remembers the Cache it was generated from, so data generated from an outdated Cache is never returned.
+// When full, the least recently used subset is evicted, and subsets unused for longer than ttl expire (0 = never).
+type subsetCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+	entries    map[string]*list.Element // key is returned by subsetKey for the split names of a subset
+	recency    *list.List               // elements are *subsetEntry, most recently used first
+	hits       uint64
+	misses     uint64
+	evictions  uint64
+}
+
+// subsetEntry contains the serialized data of a subset and the Cache it was generated from
+type subsetEntry struct {
+	key            string
+	splitNames     []string
+	cache          *Cache
+	serializedData string
+	lastUsed       time.Time
+}
+
+// newSubsetCache returns an empty subsetCache holding up to defaultMaxSubsets subsets
+func newSubsetCache() *subsetCache {
+	return &subsetCache{
+		maxEntries: defaultMaxSubsets,
+		now:        time.Now,
+		entries:    map[string]*list.Element{},
+		recency:    list.New(),
+	}
+}
+
+// setLimits sets the maximum number of subsets (minimum 1) and the TTL of unused subsets,
+// evicting subsets above the new maximum
+func (subsets *subsetCache) setLimits(maxEntries int, ttl time.Duration) {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	subsets.mutex.Lock()
+	defer subsets.mutex.Unlock()
+	subsets.maxEntries = maxEntries
+	subsets.ttl = ttl
+	subsets.evictOverflow()
+}
+
+// get returns the serialized data of a subset if it was generated from cache, marking the subset as used
+func (subsets *subsetCache) get(key string, cache *Cache) (string, bool) {
+	subsets.mutex.Lock()
+	defer subsets.mutex.Unlock()
+	element, found := subsets.entries[key]
+	if !found {
+		subsets.misses++
+		return "", false
+	}
+	entry := element.Value.(*subsetEntry)
+	now := subsets.now()
+	if subsets.isExpired(entry, now) {
+		subsets.remove(element)
+		subsets.misses++
+		return "", false
+	}
+	entry.lastUsed = now
+	subsets.recency.MoveToFront(element)
+	if entry.cache != cache {
+		subsets.misses++
+		return "", false
+	}
+	subsets.hits++
+	return entry.serializedData, true
+}
+
+// set stores the serialized data of a subset generated from cache,
+// unless the subset was already generated from a more recent Cache
+func (subsets *subsetCache) set(key string, splitNames []string, cache *Cache, serializedData string) {
+	subsets.mutex.Lock()
+	defer subsets.mutex.Unlock()
+	if element, found := subsets.entries[key]; found {
+		subsets.update(element.Value.(*subsetEntry), cache, serializedData)
+		return
+	}
+	entry := &subsetEntry{key: key, splitNames: splitNames, cache: cache, serializedData: serializedData, lastUsed: subsets.now()}
+	subsets.entries[key] = subsets.recency.PushFront(entry)
+	subsets.evictOverflow()
+}
+
+// refresh replaces the serialized data of a subset still in the cache, without marking it as used
+func (subsets *subsetCache) refresh(key string, cache *Cache, serializedData string) {
+	subsets.mutex.Lock()
+	defer subsets.mutex.Unlock()
+	if element, found := subsets.entries[key]; found {
+		subsets.update(element.Value.(*subsetEntry), cache, serializedData)
+	}
+}
+
+// splitNames removes the expired subsets and returns the split names of the remaining ones by key
+func (subsets *subsetCache) splitNames() map[string][]string {
+	subsets.mutex.Lock()
+	defer subsets.mutex.Unlock()
+	now := subsets.now()
+	splitNames := make(map[string][]string, len(subsets.entries))
+	for element := subsets.recency.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*subsetEntry)
+		if subsets.isExpired(entry, now) {
+			subsets.remove(element)
+		} else {
+			splitNames[entry.key] = entry.splitNames
+		}
+		element = next
+	}
+	return splitNames
+}
+
+// stats returns the usage statistics of the cache
+func (subsets *subsetCache) stats() SubsetCacheStats {
+	subsets.mutex.Lock()
+	defer subsets.mutex.Unlock()
+	return SubsetCacheStats{
+		Hits:      subsets.hits,
+		Misses:    subsets.misses,
+		Evictions: subsets.evictions,
+		Size:      len(subsets.entries),
+	}
+}
+
+// update replaces the serialized data of entry unless it was generated from a more recent Cache.
+// The mutex must be held.
+func (subsets *subsetCache) update(entry *subsetEntry, cache *Cache, serializedData string) {
+	if entry.cache.version > cache.version {
+		return
+	}
+	entry.cache = cache
+	entry.serializedData = serializedData
+}
+
+// isExpired returns whether entry was unused for longer than the TTL
+func (subsets *subsetCache) isExpired(entry *subsetEntry, now time.Time) bool {
+	return subsets.ttl > 0 && now.Sub(entry.lastUsed) > subsets.ttl
+}
+
+// evictOverflow removes the least recently used subsets above the maximum. The mutex must be held.
+func (subsets *subsetCache) evictOverflow() {
+	for subsets.recency.Len() > subsets.maxEntries {
+		subsets.remove(subsets.recency.Back())
+	}
+}
+
+// remove evicts the subset of element. The mutex must be held.
+func (subsets *subsetCache) remove(element *list.Element) {
+	subsets.recency.Remove(element)
+	delete(subsets.entries, element.Value.(*subsetEntry).key)
+	subsets.evictions++
+}
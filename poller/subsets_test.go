@@ -0,0 +1,196 @@
+package poller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serializedDataSubsets returns a copy of the serialized data of all the subsets, for tests to inspect the cache
+func (subsets *subsetCache) serializedDataSubsets() map[string]string {
+	subsets.mutex.Lock()
+	defer subsets.mutex.Unlock()
+	serializedDataSubsets := make(map[string]string, len(subsets.entries))
+	for key, element := range subsets.entries {
+		serializedDataSubsets[key] = element.Value.(*subsetEntry).serializedData
+	}
+	return serializedDataSubsets
+}
+
+func TestSubsetKeySortsAndDeduplicatesSplitNames(t *testing.T) {
+	// Act
+	key, splitNames := subsetKey([]string{"mock-split-2", "mock-split-1", "mock-split-2"})
+	sameKey, _ := subsetKey([]string{"mock-split-1", "mock-split-2"})
+
+	// Validate
+	assert.Equal(t, splitNames, []string{"mock-split-1", "mock-split-2"})
+	assert.Equal(t, key, sameKey)
+}
+
+func TestSubsetKeyDoesNotCollideForSplitNamesContainingPeriods(t *testing.T) {
+	// Act
+	dottedKey, dottedSplitNames := subsetKey([]string{"checkout.v2"})
+	splitKey, splitSplitNames := subsetKey([]string{"v2", "checkout"})
+
+	// Validate
+	assert.Equal(t, dottedSplitNames, []string{"checkout.v2"})
+	assert.Equal(t, splitSplitNames, []string{"checkout", "v2"})
+	assert.NotEqual(t, dottedKey, splitKey)
+}
+
+func TestSubsetKeyDoesNotModifySplitNames(t *testing.T) {
+	// Arrange
+	splitNames := []string{"mock-split-2", "mock-split-1", "mock-split-2"}
+
+	// Act
+	subsetKey(splitNames)
+
+	// Validate
+	assert.Equal(t, splitNames, []string{"mock-split-2", "mock-split-1", "mock-split-2"})
+}
+
+func TestSubsetCacheGetReturnsDataGeneratedFromCache(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	cache := &Cache{version: 1}
+	subsets.set("mock-split", []string{"mock-split"}, cache, "mock-data")
+
+	// Act
+	result, found := subsets.get("mock-split", cache)
+
+	// Validate
+	assert.True(t, found)
+	assert.Equal(t, result, "mock-data")
+}
+
+func TestSubsetCacheGetIgnoresDataGeneratedFromAnotherCache(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	subsets.set("mock-split", []string{"mock-split"}, &Cache{version: 1}, "mock-data")
+
+	// Act
+	result, found := subsets.get("mock-split", &Cache{version: 2})
+
+	// Validate
+	assert.False(t, found)
+	assert.Equal(t, result, "")
+}
+
+func TestSubsetCacheSetKeepsDataGeneratedFromNewerCache(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	newerCache := &Cache{version: 2}
+	subsets.set("mock-split", []string{"mock-split"}, newerCache, "newer-data")
+
+	// Act
+	subsets.set("mock-split", []string{"mock-split"}, &Cache{version: 1}, "older-data")
+	result, found := subsets.get("mock-split", newerCache)
+
+	// Validate
+	assert.True(t, found)
+	assert.Equal(t, result, "newer-data")
+}
+
+func TestSubsetCacheSerializedDataSubsetsReturnsCopy(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	subsets.set("mock-split", []string{"mock-split"}, &Cache{}, "mock-data")
+
+	// Act
+	result := subsets.serializedDataSubsets()
+	result["mock-split"] = "changed"
+
+	// Validate
+	assert.Equal(t, subsets.serializedDataSubsets(), map[string]string{"mock-split": "mock-data"})
+	assert.Equal(t, subsets.splitNames(), map[string][]string{"mock-split": {"mock-split"}})
+}
+
+func TestSubsetCacheEvictsLeastRecentlyUsedSubset(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	subsets.setLimits(2, 0)
+	cache := &Cache{}
+	subsets.set("mock-split-1", []string{"mock-split-1"}, cache, "data-1")
+	subsets.set("mock-split-2", []string{"mock-split-2"}, cache, "data-2")
+	subsets.get("mock-split-1", cache)
+
+	// Act
+	subsets.set("mock-split-3", []string{"mock-split-3"}, cache, "data-3")
+
+	// Validate that mock-split-2, the least recently used subset, was evicted
+	assert.Equal(t, subsets.serializedDataSubsets(), map[string]string{
+		"mock-split-1": "data-1",
+		"mock-split-3": "data-3",
+	})
+	assert.Equal(t, subsets.stats(), SubsetCacheStats{Hits: 1, Evictions: 1, Size: 2})
+}
+
+func TestSubsetCacheSetLimitsEvictsSubsetsAboveMaximum(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	cache := &Cache{}
+	subsets.set("mock-split-1", []string{"mock-split-1"}, cache, "data-1")
+	subsets.set("mock-split-2", []string{"mock-split-2"}, cache, "data-2")
+	subsets.set("mock-split-3", []string{"mock-split-3"}, cache, "data-3")
+
+	// Act
+	subsets.setLimits(0, 0)
+
+	// Validate that the maximum is at least 1 and the most recently used subset is kept
+	assert.Equal(t, subsets.splitNames(), map[string][]string{"mock-split-3": {"mock-split-3"}})
+	assert.Equal(t, subsets.stats().Evictions, uint64(2))
+}
+
+func TestSubsetCacheExpiresUnusedSubsets(t *testing.T) {
+	// Arrange
+	now := time.Unix(0, 0)
+	subsets := newSubsetCache()
+	subsets.now = func() time.Time { return now }
+	subsets.setLimits(defaultMaxSubsets, time.Minute)
+	cache := &Cache{}
+	subsets.set("mock-split-1", []string{"mock-split-1"}, cache, "data-1")
+	subsets.set("mock-split-2", []string{"mock-split-2"}, cache, "data-2")
+	now = now.Add(45 * time.Second)
+	subsets.get("mock-split-1", cache)
+
+	// Act
+	now = now.Add(45 * time.Second)
+	_, foundExpired := subsets.get("mock-split-2", cache)
+	splitNames := subsets.splitNames()
+
+	// Validate that only the subset unused for longer than the TTL expired
+	assert.False(t, foundExpired)
+	assert.Equal(t, splitNames, map[string][]string{"mock-split-1": {"mock-split-1"}})
+	assert.Equal(t, subsets.stats(), SubsetCacheStats{Hits: 1, Misses: 1, Evictions: 1, Size: 1})
+}
+
+func TestSubsetCacheRefreshDoesNotAddEvictedSubsets(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	subsets.setLimits(1, 0)
+	cache := &Cache{version: 1}
+	subsets.set("mock-split-1", []string{"mock-split-1"}, cache, "data-1")
+	subsets.set("mock-split-2", []string{"mock-split-2"}, cache, "data-2")
+
+	// Act
+	newCache := &Cache{version: 2}
+	subsets.refresh("mock-split-1", newCache, "new-data-1")
+	subsets.refresh("mock-split-2", newCache, "new-data-2")
+
+	// Validate
+	assert.Equal(t, subsets.serializedDataSubsets(), map[string]string{"mock-split-2": "new-data-2"})
+}
+
+func TestSubsetCacheCountsMissesForOutdatedSubsets(t *testing.T) {
+	// Arrange
+	subsets := newSubsetCache()
+	subsets.set("mock-split", []string{"mock-split"}, &Cache{version: 1}, "data")
+
+	// Act
+	subsets.get("mock-split", &Cache{version: 2})
+	subsets.get("mock-split-2", &Cache{version: 2})
+
+	// Validate
+	assert.Equal(t, subsets.stats(), SubsetCacheStats{Misses: 2, Size: 1})
+}